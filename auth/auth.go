@@ -17,11 +17,30 @@ var secret = []byte(os.Getenv("JWT_SECRET"))
 type Claims struct {
 	jwt.StandardClaims
 	Username string
+	// Scopes restricts what the bearer may do. It is only set when the
+	// request was authenticated with a personal access token, a JWT session
+	// carries no scopes and is allowed everything.
+	Scopes []string `json:"-"`
+	// Personal is true when the claims come from a personal access token
+	Personal bool `json:"-"`
 }
 
 // NewClaims creates custom claims given standard claim and username
 func NewClaims(claims jwt.StandardClaims, username string) *Claims {
-	return &Claims{claims, username}
+	return &Claims{StandardClaims: claims, Username: username}
+}
+
+// HasScope check if the claims allow the given scope
+func (c *Claims) HasScope(scope string) bool {
+	if !c.Personal {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 // Tokener is how the handlers will interface with tokens
@@ -81,12 +100,14 @@ func validateToken(tokenString string) (*Claims, error) {
 // CheckRequest ensures that the JWT provided in the header of
 // the request is valid, and then returns claims
 func (JWT) CheckRequest(r *http.Request) (*Claims, error) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		return nil, fmt.Errorf("Authorization header is empty")
+	token, err := ExtractToken(r)
+	if err != nil {
+		return nil, err
 	}
 
-	token := strings.TrimPrefix(auth, "Token ")
+	if IsPersonalToken(token) {
+		return nil, fmt.Errorf("Personal access tokens are not JWTs")
+	}
 
 	claims, err := validateToken(token)
 	if err != nil {
@@ -94,3 +115,20 @@ func (JWT) CheckRequest(r *http.Request) (*Claims, error) {
 	}
 	return claims, nil
 }
+
+// ExtractToken returns the raw token sent in the Authorization header,
+// accepting both the "Token" and "Bearer" schemes
+func ExtractToken(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", fmt.Errorf("Authorization header is empty")
+	}
+
+	for _, scheme := range []string{"Token ", "Bearer "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimSpace(strings.TrimPrefix(auth, scheme)), nil
+		}
+	}
+
+	return strings.TrimSpace(auth), nil
+}
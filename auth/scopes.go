@@ -0,0 +1,42 @@
+package auth
+
+import "strings"
+
+// PersonalTokenPrefix prefixes every personal access token so it can be told
+// apart from a JWT in the Authorization header
+const PersonalTokenPrefix = "cdt_"
+
+// Scopes that can be granted to a personal access token
+const (
+	ScopeReadArticles   = "read:articles"
+	ScopeWriteArticles  = "write:articles"
+	ScopeWriteFavorites = "write:favorites"
+)
+
+// Scopes lists every known scope
+var Scopes = []string{
+	ScopeReadArticles,
+	ScopeWriteArticles,
+	ScopeWriteFavorites,
+}
+
+// IsPersonalToken check if the raw token is a personal access token
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
+
+// IsValidScope check if the scope is a known scope
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPersonalClaims creates claims for a request authenticated
+// with a personal access token
+func NewPersonalClaims(username string, scopes []string) *Claims {
+	return &Claims{Username: username, Scopes: scopes, Personal: true}
+}
@@ -0,0 +1,78 @@
+// Package cache keeps short lived values either in process or in a Redis
+// server shared by every instance of the application.
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache stores values by key for a limited time. Implementations are safe
+// for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key or ErrMiss. The returned
+	// slice must not be modified.
+	Get(key string) ([]byte, error)
+	// Set stores value under key for ttl, without expiration when ttl is 0
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys, missing keys are ignored
+	Delete(keys ...string) error
+}
+
+// ErrMiss is returned by Get when the key is not cached
+var ErrMiss = fmt.Errorf("Cache miss")
+
+// DefaultSize is the number of entries of the LRU opened by default
+const DefaultSize = 10000
+
+// Open returns the cache described by rawurl:
+//
+//	memory://?size=10000&bytes=0           in process LRU, the default
+//	redis://[:password@]host[:port][/db]   Redis server
+//
+// An empty rawurl opens an LRU of DefaultSize entries.
+func Open(rawurl string) (Cache, error) {
+	if rawurl == "" {
+		return NewLRU(DefaultSize, 0), nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "memory":
+		size, bytes := DefaultSize, 0
+		if v := u.Query().Get("size"); v != "" {
+			if size, err = strconv.Atoi(v); err != nil || size < 1 {
+				return nil, fmt.Errorf("Invalid cache size: %s", v)
+			}
+		}
+		if v := u.Query().Get("bytes"); v != "" {
+			if bytes, err = strconv.Atoi(v); err != nil || bytes < 0 {
+				return nil, fmt.Errorf("Invalid cache bytes: %s", v)
+			}
+		}
+		return NewLRU(size, bytes), nil
+	case "redis":
+		r := NewRedis(u.Host)
+		if u.Port() == "" {
+			r.Addr = u.Host + ":6379"
+		}
+		if p, ok := u.User.Password(); ok {
+			r.Password = p
+		}
+		if db := strings.Trim(u.Path, "/"); db != "" {
+			if r.DB, err = strconv.Atoi(db); err != nil {
+				return nil, fmt.Errorf("Invalid Redis database: %s", db)
+			}
+		}
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported cache scheme: %s", u.Scheme)
+}
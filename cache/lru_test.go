@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_GetSet(t *testing.T) {
+	c := NewLRU(10, 0)
+
+	if _, err := c.Get("a"); err != ErrMiss {
+		t.Errorf("should miss an unknown key: got %v want %v", err, ErrMiss)
+	}
+
+	value := []byte("1")
+	c.Set("a", value, 0)
+	value[0] = '2'
+
+	got, err := c.Get("a")
+	if err != nil || string(got) != "1" {
+		t.Errorf("should return a copy of the value: got %q, %v want %q", got, err, "1")
+	}
+
+	c.Set("a", []byte("3"), 0)
+	if got, _ := c.Get("a"); string(got) != "3" {
+		t.Errorf("should replace the value: got %q want %q", got, "3")
+	}
+
+	c.Delete("a", "unknown")
+	if _, err := c.Get("a"); err != ErrMiss {
+		t.Errorf("should miss a deleted key: got %v want %v", err, ErrMiss)
+	}
+}
+
+func TestLRU_TTL(t *testing.T) {
+	c := NewLRU(10, 0)
+	c.Set("a", []byte("1"), time.Millisecond)
+	c.Set("b", []byte("2"), time.Hour)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := c.Get("a"); err != ErrMiss {
+		t.Errorf("should miss an expired key: got %v want %v", err, ErrMiss)
+	}
+	if _, err := c.Get("b"); err != nil {
+		t.Errorf("should keep a live key: got %v", err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("should drop the expired entry: got %v want %v", c.Len(), 1)
+	}
+}
+
+func TestLRU_Eviction(t *testing.T) {
+	c := NewLRU(2, 0)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Get("a")
+	c.Set("c", []byte("3"), 0)
+
+	if _, err := c.Get("b"); err != ErrMiss {
+		t.Errorf("should evict the least recently used entry: got %v want %v", err, ErrMiss)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := c.Get(key); err != nil {
+			t.Errorf("should keep %q: got %v", key, err)
+		}
+	}
+
+	c = NewLRU(10, 8)
+	c.Set("a", []byte("1234"), 0)
+	c.Set("b", []byte("1234"), 0)
+	if c.Len() != 1 {
+		t.Errorf("should evict entries over the byte limit: got %v want %v", c.Len(), 1)
+	}
+
+	c.Set("c", []byte("0123456789"), 0)
+	if _, err := c.Get("c"); err != ErrMiss {
+		t.Errorf("should not cache a value larger than the byte limit: got %v want %v", err, ErrMiss)
+	}
+	if _, err := c.Get("b"); err != nil {
+		t.Errorf("should keep the entries when skipping a large value: got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		url  string
+		want interface{}
+	}{
+		{"", &LRU{}},
+		{"memory://?size=5&bytes=100", &LRU{}},
+		{"redis://:secret@localhost/2", &Redis{}},
+	}
+
+	for _, tt := range tests {
+		c, err := Open(tt.url)
+		if err != nil {
+			t.Errorf("%q should open: got %v", tt.url, err)
+			continue
+		}
+		switch c := c.(type) {
+		case *LRU:
+			if _, ok := tt.want.(*LRU); !ok {
+				t.Errorf("%q should open a %T: got %T", tt.url, tt.want, c)
+			}
+		case *Redis:
+			if _, ok := tt.want.(*Redis); !ok {
+				t.Errorf("%q should open a %T: got %T", tt.url, tt.want, c)
+			}
+			if c.Addr != "localhost:6379" || c.Password != "secret" || c.DB != 2 {
+				t.Errorf("%q should parse the server: got %v %v %v", tt.url, c.Addr, c.Password, c.DB)
+			}
+		}
+	}
+
+	for _, url := range []string{"memory://?size=0", "redis://localhost/db", "memcache://localhost"} {
+		if _, err := Open(url); err == nil {
+			t.Errorf("%q should not open", url)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRedisPrefix namespaces the keys stored in Redis
+const DefaultRedisPrefix = "conduit:"
+
+// DefaultRedisTimeout bounds dialing and every command round trip
+const DefaultRedisTimeout = time.Second
+
+// maxIdleRedisConns is the number of connections kept open between commands
+const maxIdleRedisConns = 8
+
+// Redis is a Cache stored in a Redis server, or anything speaking its
+// protocol, so it is shared by every instance of the application. It only
+// relies on GET, SET with PX and DEL.
+type Redis struct {
+	Addr     string
+	Password string
+	DB       int
+	Prefix   string
+	Timeout  time.Duration
+
+	idle chan *redisConn
+}
+
+// redisError is an error reply of the server. Unlike network errors it
+// leaves the connection usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "Redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewRedis returns a Redis cache connecting to the server at addr
+func NewRedis(addr string) *Redis {
+	return &Redis{
+		Addr:    addr,
+		Prefix:  DefaultRedisPrefix,
+		Timeout: DefaultRedisTimeout,
+		idle:    make(chan *redisConn, maxIdleRedisConns),
+	}
+}
+
+// Get returns the value stored under key
+func (r *Redis) Get(key string) ([]byte, error) {
+	reply, err := r.do("GET", r.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrMiss
+	}
+	return value, nil
+}
+
+// Set stores value under key, Redis expires it after ttl
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", r.Prefix + key, string(value)}
+	if ttl > 0 {
+		// PX must be at least 1
+		ms := int64(ttl / time.Millisecond)
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := r.do(args...)
+	return err
+}
+
+// Delete removes the keys
+func (r *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, r.Prefix+key)
+	}
+	_, err := r.do(args...)
+	return err
+}
+
+// Ping checks the server can be reached
+func (r *Redis) Ping() error {
+	_, err := r.do("PING")
+	return err
+}
+
+// Close closes the idle connections
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply: nil, a string, an int64, a
+// []byte or a []interface{} of those
+func (r *Redis) do(args ...string) (interface{}, error) {
+	c, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetDeadline(time.Now().Add(r.Timeout))
+	err = writeCommand(c.w, args)
+
+	var reply interface{}
+	if err == nil {
+		reply, err = readReply(c.r)
+	}
+
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.Close()
+		return nil, err
+	}
+
+	select {
+	case r.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one
+func (r *Redis) conn() (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+
+	nc, err := net.DialTimeout("tcp", r.Addr, r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]string
+	if r.Password != "" {
+		setup = append(setup, []string{"AUTH", r.Password})
+	}
+	if r.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.DB)})
+	}
+
+	c.SetDeadline(time.Now().Add(r.Timeout))
+	for _, args := range setup {
+		if err = writeCommand(c.w, args); err == nil {
+			_, err = readReply(c.r)
+		}
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// writeCommand sends a command as a RESP array of bulk strings
+func writeCommand(w *bufio.Writer, args []string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return w.Flush()
+}
+
+// readReply decodes a RESP reply
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("Invalid Redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+
+	return nil, fmt.Errorf("Invalid Redis reply: %q", line)
+}
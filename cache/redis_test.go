@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a local stand-in for a Redis server implementing the
+// commands used by the Redis cache
+type fakeRedis struct {
+	net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	expires  map[string]time.Time
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &fakeRedis{
+		Listener: l,
+		password: password,
+		values:   make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	authenticated := s.password == ""
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = args[1] == s.password
+			if authenticated {
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			w.WriteString("-NOAUTH Authentication required\r\n")
+		case cmd == "PING":
+			w.WriteString("+PONG\r\n")
+		case cmd == "SELECT":
+			w.WriteString("+OK\r\n")
+		case cmd == "GET":
+			value, ok := s.values[args[1]]
+			if e, expiring := s.expires[args[1]]; expiring && time.Now().After(e) {
+				ok = false
+			}
+			if ok {
+				w.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + string(value) + "\r\n")
+			} else {
+				w.WriteString("$-1\r\n")
+			}
+		case cmd == "SET":
+			s.values[args[1]] = []byte(args[2])
+			delete(s.expires, args[1])
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			w.WriteString("+OK\r\n")
+		case cmd == "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := s.values[key]; ok {
+					delete(s.values, key)
+					n++
+				}
+			}
+			w.WriteString(":" + strconv.Itoa(n) + "\r\n")
+		default:
+			w.WriteString("-ERR unknown command '" + args[0] + "'\r\n")
+		}
+		s.mu.Unlock()
+		w.Flush()
+	}
+}
+
+func (s *fakeRedis) commandsSent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func TestRedis_GetSetDelete(t *testing.T) {
+	s := newFakeRedis(t, "")
+	c := NewRedis(s.Addr().String())
+	defer c.Close()
+
+	if _, err := c.Get("a"); err != ErrMiss {
+		t.Errorf("should miss an unknown key: got %v want %v", err, ErrMiss)
+	}
+
+	value := "binary\r\n\x00value"
+	if err := c.Set("a", []byte(value), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get("a")
+	if err != nil || string(got) != value {
+		t.Errorf("should return the value: got %q, %v want %q", got, err, value)
+	}
+
+	if err := c.Delete("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("a"); err != ErrMiss {
+		t.Errorf("should miss a deleted key: got %v want %v", err, ErrMiss)
+	}
+
+	sent := s.commandsSent()
+	if sent[len(sent)-2] != "DEL conduit:a conduit:b" {
+		t.Errorf("should prefix the keys: got %q", sent[len(sent)-2])
+	}
+}
+
+func TestRedis_TTL(t *testing.T) {
+	s := newFakeRedis(t, "")
+	c := NewRedis(s.Addr().String())
+	defer c.Close()
+
+	c.Set("a", []byte("1"), 1500*time.Microsecond)
+	sent := s.commandsSent()
+	if last := sent[len(sent)-1]; last != "SET conduit:a 1 PX 1" {
+		t.Errorf("should send the ttl in milliseconds: got %q", last)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := c.Get("a"); err != ErrMiss {
+		t.Errorf("should miss an expired key: got %v want %v", err, ErrMiss)
+	}
+}
+
+func TestRedis_Connections(t *testing.T) {
+	s := newFakeRedis(t, "secret")
+
+	c := NewRedis(s.Addr().String())
+	if err := c.Ping(); err == nil {
+		t.Errorf("should return the error replies")
+	}
+	c.Close()
+
+	c = NewRedis(s.Addr().String())
+	c.Password = "secret"
+	c.DB = 3
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := c.Ping(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var auth, selects int
+	for _, cmd := range s.commandsSent() {
+		switch {
+		case strings.HasPrefix(cmd, "AUTH secret"):
+			auth++
+		case cmd == "SELECT 3":
+			selects++
+		}
+	}
+	if auth != 1 || selects != 1 {
+		t.Errorf("should authenticate and select the database once per connection: got %v %v", auth, selects)
+	}
+
+	s.Close()
+	c.Close()
+	if err := c.Ping(); err == nil {
+		t.Errorf("should fail without server")
+	}
+}
@@ -0,0 +1,215 @@
+// Package diff computes line based unified diffs
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines shown around each change
+const Context = 3
+
+// MaxChangedLines bounds the lines between the common prefix and suffix
+// of each text. The edit script is computed from a table of their product,
+// larger diffs fail with ErrTooLarge.
+const MaxChangedLines = 1000
+
+// ErrTooLarge is returned when the texts differ on too many lines to be
+// diffed
+var ErrTooLarge = fmt.Errorf("The texts differ on too many lines to be diffed")
+
+type opKind int
+
+const (
+	equal opKind = iota
+	del
+	ins
+)
+
+type op struct {
+	kind opKind
+	line string
+	// a and b are the line indexes in the old and new text
+	a, b int
+}
+
+// Unified returns the unified diff turning a into b, labelled with the
+// given names. It returns an empty string when both texts are equal.
+func Unified(aName, bName, a, b string) (string, error) {
+	if a == b {
+		return "", nil
+	}
+
+	ops, err := lineOps(splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for _, h := range hunks(ops) {
+		writeHunk(&sb, ops[h[0]:h[1]])
+	}
+	return sb.String(), nil
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineOps returns the edit script between a and b from their longest
+// common subsequence. Only the lines between their common prefix and
+// suffix go through the LCS table.
+func lineOps(a, b []string) ([]op, error) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if len(a)-prefix-suffix > MaxChangedLines || len(b)-prefix-suffix > MaxChangedLines {
+		return nil, ErrTooLarge
+	}
+
+	var ops []op
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{equal, a[i], i, i})
+	}
+	for _, o := range lcsOps(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		o.a += prefix
+		o.b += prefix
+		ops = append(ops, o)
+	}
+	for k := suffix; k > 0; k-- {
+		i, j := len(a)-k, len(b)-k
+		ops = append(ops, op{equal, a[i], i, j})
+	}
+	return ops, nil
+}
+
+func lcsOps(a, b []string) []op {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{equal, a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{del, a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{ins, b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// hunks groups the changes with their context and returns the [start, end)
+// ranges of ops making each hunk
+func hunks(ops []op) [][2]int {
+	var res [][2]int
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == equal {
+			continue
+		}
+
+		start := i - Context
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while the next change is close enough
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == equal {
+				next++
+			}
+			if next == len(ops) || next-end > 2*Context {
+				if next-end < Context {
+					end = next
+				} else {
+					end += Context
+				}
+				break
+			}
+			end = next
+		}
+
+		if n := len(res); n > 0 && start <= res[n-1][1] {
+			res[n-1][1] = end
+		} else {
+			res = append(res, [2]int{start, end})
+		}
+		i = end - 1
+	}
+	return res
+}
+
+func writeHunk(sb *strings.Builder, ops []op) {
+	aStart, bStart := ops[0].a, ops[0].b
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != ins {
+			aLen++
+		}
+		if o.kind != del {
+			bLen++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		switch o.kind {
+		case equal:
+			sb.WriteString(" ")
+		case del:
+			sb.WriteString("-")
+		case ins:
+			sb.WriteString("+")
+		}
+		sb.WriteString(o.line)
+		sb.WriteString("\n")
+	}
+}
+
+// hunkRange formats a hunk range, line numbers start at 1 and an empty
+// range points at the line before it
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"Equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"Change",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"Insert",
+			"",
+			"a\n",
+			"--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"Delete",
+			"a\nb\n",
+			"a\n",
+			"--- old\n+++ new\n@@ -1,2 +1 @@\n a\n-b\n",
+		},
+		{
+			"Hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Unified("old", "new", tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnified_TooLarge(t *testing.T) {
+	lines := func(prefix string, n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&sb, "%s%d\n", prefix, i)
+		}
+		return sb.String()
+	}
+
+	if _, err := Unified("old", "new", lines("a", MaxChangedLines+1), lines("b", 1)); err != ErrTooLarge {
+		t.Errorf("should refuse to diff too many changed lines: got %v want %v", err, ErrTooLarge)
+	}
+
+	// The common lines don't count
+	same := lines("a", 2*MaxChangedLines)
+	got, err := Unified("old", "new", same+"old\n"+same, same+"new\n"+same)
+	if err != nil {
+		t.Fatalf("should diff large texts with few changes: got %v", err)
+	}
+	want := fmt.Sprintf("--- old\n+++ new\n@@ -%d,7 +%d,7 @@\n a%d\n a%d\n a%d\n-old\n+new\n a0\n a1\n a2\n",
+		2*MaxChangedLines-2, 2*MaxChangedLines-2, 2*MaxChangedLines-3, 2*MaxChangedLines-2, 2*MaxChangedLines-1)
+	if got != want {
+		t.Errorf("should only diff the changed lines: got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -5,22 +5,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/JackyChiu/realworld-starter-kit/auth"
 	"github.com/JackyChiu/realworld-starter-kit/models"
 )
 
 type Article struct {
-	Slug           string    `json:"slug"`
-	Title          string    `json:"title"`
-	Description    string    `json:"description"`
-	Body           string    `json:"body"`
-	Favorited      bool      `json:"favorited"`
-	FavoritesCount int       `json:"favoritesCount"`
-	TagsList       []string  `json:"tagsList"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-	Author         Author    `json:"user"`
+	Slug           string     `json:"slug"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	Body           string     `json:"body"`
+	BodyHTML       string     `json:"bodyHtml,omitempty"`
+	Favorited      bool       `json:"favorited"`
+	FavoritesCount int        `json:"favoritesCount"`
+	TagsList       []string   `json:"tagsList"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	Status         string     `json:"status"`
+	PublishAt      *time.Time `json:"publishAt,omitempty"`
+	PublishedAt    *time.Time `json:"publishedAt"`
+	Version        int        `json:"version"`
+	Author         Author     `json:"user"`
 }
 
 type Author struct {
@@ -55,32 +63,56 @@ func (h *Handler) ArticlesHandler(w http.ResponseWriter, r *http.Request) {
 	router := NewRouter(h.Logger)
 	router.AddRoute(
 		`articles\/?$`,
-		"GET", h.getCurrentUser(h.getArticles))
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.getArticles)))
 
 	router.AddRoute(
 		`articles\/(?P<slug>[0-9a-zA-Z\-]+)$`,
-		"GET", h.getCurrentUser(h.extractArticle(h.getArticle)))
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.extractArticle(h.getArticle))))
 
 	// Protected routes
 	router.AddRoute(
 		`articles\/?$`,
-		"POST", h.getCurrentUser(h.authorize(h.createArticle)))
+		"POST", h.getCurrentUser(h.rateLimit(RateLimitArticles, h.authorize(h.requireScope(auth.ScopeWriteArticles, h.createArticle)))))
 
 	router.AddRoute(
 		`articles\/(?P<slug>[0-9a-zA-Z\-]+)$`,
-		"PUT", h.getCurrentUser(h.authorize(h.extractArticle(h.updateArticle))))
+		"PUT", h.getCurrentUser(h.rateLimit(RateLimitArticles, h.authorize(h.requireScope(auth.ScopeWriteArticles, h.extractArticle(h.updateArticle))))))
 
 	router.AddRoute(
 		`articles\/(?P<slug>[0-9a-zA-Z\-]+)$`,
-		"DELETE", h.getCurrentUser(h.authorize(h.extractArticle(h.deleteArticle))))
+		"DELETE", h.getCurrentUser(h.rateLimit(RateLimitArticles, h.authorize(h.requireScope(auth.ScopeWriteArticles, h.extractArticle(h.deleteArticle))))))
+
+	router.AddRoute(
+		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/related$`,
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.extractArticle(h.getRelatedArticles))))
+
+	router.AddRoute(
+		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/revisions\/?$`,
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.extractArticle(h.getRevisions))))
+
+	router.AddRoute(
+		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/revisions\/(?P<number>[0-9]+)$`,
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.extractArticle(h.extractRevision(h.getRevision)))))
+
+	router.AddRoute(
+		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/revisions\/(?P<number>[0-9]+)\/diff$`,
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.extractArticle(h.extractRevision(h.diffRevision)))))
+
+	router.AddRoute(
+		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/revisions\/(?P<number>[0-9]+)\/revert$`,
+		"POST", h.getCurrentUser(h.rateLimit(RateLimitArticles, h.authorize(h.requireScope(auth.ScopeWriteArticles, h.extractArticle(h.extractRevision(h.revertArticle)))))))
+
+	router.AddRoute(
+		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/restore$`,
+		"POST", h.getCurrentUser(h.rateLimit(RateLimitArticles, h.authorize(h.requireScope(auth.ScopeWriteArticles, h.restoreArticle)))))
 
 	router.AddRoute(
 		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/favorite$`,
-		"POST", h.getCurrentUser(h.authorize(h.extractArticle(h.favoriteArticle))))
+		"POST", h.getCurrentUser(h.rateLimit(RateLimitFavorites, h.authorize(h.requireScope(auth.ScopeWriteFavorites, h.extractArticle(h.favoriteArticle))))))
 
 	router.AddRoute(
 		`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/favorite$`,
-		"DELETE", h.getCurrentUser(h.authorize(h.extractArticle(h.unFavoriteArticle))))
+		"DELETE", h.getCurrentUser(h.rateLimit(RateLimitFavorites, h.authorize(h.requireScope(auth.ScopeWriteFavorites, h.extractArticle(h.unFavoriteArticle))))))
 
 	//router.DebugMode(true)
 
@@ -88,33 +120,39 @@ func (h *Handler) ArticlesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) getCurrentUser(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return traceStep("getCurrentUser", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		var u = &models.User{}
 		ctx := r.Context()
 
-		if claim, _ := h.JWT.CheckRequest(r); claim != nil {
-			u, _ = h.DB.FindUserByUsername(claim.Username)
+		if claim, _ := h.checkRequest(r); claim != nil {
+			u, _ = h.store(r).FindUserByUsername(claim.Username)
 			ctx = context.WithValue(ctx, Claim, claim)
+			setLogUser(ctx, claim.Username)
 		}
 
 		ctx = context.WithValue(ctx, CurrentUser, u)
 
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
-	}
+	})
 }
 
 func (h *Handler) extractArticle(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return traceStep("extractArticle", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		ctx := r.Context()
 		if slug, ok := ctx.Value("slug").(string); ok {
-			a, err := h.DB.GetArticle(slug)
+			a, err := h.store(r).GetArticle(slug)
 
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusNotFound)
 				return
 			}
 
+			if u, ok := ctx.Value(CurrentUser).(*models.User); !ok || !a.IsVisibleTo(u.ID) {
+				http.NotFound(w, r)
+				return
+			}
+
 			if a != nil {
 				ctx := r.Context()
 				ctx = context.WithValue(ctx, FetchedArticle, a)
@@ -122,18 +160,32 @@ func (h *Handler) extractArticle(next http.HandlerFunc) http.HandlerFunc {
 			}
 		}
 		next.ServeHTTP(w, r)
-	}
+	})
 }
 
 func (h *Handler) authorize(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	return traceStep("authorize", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		if claim := r.Context().Value(Claim); claim == nil {
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
 
 		next.ServeHTTP(w, r)
-	}
+	})
+}
+
+// requireScope rejects requests authenticated with a personal access token
+// that was not granted the given scope
+func (h *Handler) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return traceStep("requireScope", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if claim, ok := r.Context().Value(Claim).(*auth.Claims); ok && !claim.HasScope(scope) {
+			err := fmt.Errorf("Token is missing the %s scope", scope)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (h *Handler) getArticle(w http.ResponseWriter, r *http.Request) {
@@ -143,7 +195,11 @@ func (h *Handler) getArticle(w http.ResponseWriter, r *http.Request) {
 	u := ctx.Value(CurrentUser).(*models.User)
 
 	articleJSON := ArticleJSON{
-		Article: h.buildArticleJSON(a, u),
+		Article: h.buildArticleJSON(r, a, u),
+	}
+
+	if checkNotModified(w, r, articleETag(articleJSON.Article), lastModified(articleJSON.Article)) {
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -152,81 +208,130 @@ func (h *Handler) getArticle(w http.ResponseWriter, r *http.Request) {
 
 // getArticles handle GET /api/articles
 func (h *Handler) getArticles(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var articles = []models.Article{}
+	u := r.Context().Value(CurrentUser).(*models.User)
 
-	query := h.DB.GetAllArticles()
+	query, errs := h.parseArticleQuery(r)
+	if len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(errorResponse{Errors: errs})
+		return
+	}
+	query.ViewerID = u.ID
 
-	r.ParseForm()
-	queryParams := r.Form
+	articles, err := h.store(r).GetArticles(query)
 
-	if limit, ok := queryParams["limit"]; ok {
-		query = query.Limit(limit[0])
-	} else {
-		query = query.Limit(20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	if offset, ok := queryParams["offset"]; ok {
-		query = query.Offset(offset[0])
-	} else {
-		query = query.Offset(0)
-	}
+	var articlesJSON ArticlesJSON
+	if len(articles) > 0 {
+		articlesJSON.Articles, err = h.buildArticlesJSON(r, articles, u)
 
-	err = query.Find(&articles).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if tags, ok := queryParams["tag"]; ok {
-		articles, err = h.DB.GetAllArticlesWithTag(tags[0])
+		articlesJSON.ArticlesCount = len(articles)
 	}
 
-	if authorBy, ok := queryParams["author"]; ok {
-		articles, err = h.DB.GetAllArticlesAuthoredBy(authorBy[0])
+	etag := articlesETag(articlesJSON.Articles...)
+	if checkNotModified(w, r, etag, lastModified(articlesJSON.Articles...)) {
+		return
 	}
 
-	if favoritedBy, ok := queryParams["favorited"]; ok {
-		articles, err = h.DB.GetAllArticlesFavoritedBy(favoritedBy[0])
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(articlesJSON)
+}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// parseArticleQuery reads the filters of GET /api/articles:
+//   - tag, repeated, lists articles with any of the tags, or all of them with
+//     tagMatch=all. A tag starting with - excludes the articles tagged with it
+//   - author and favorited, usernames
+//   - since and until, RFC 3339 times or dates bounding the creation time.
+//     A date until includes the whole day
+//   - sort, limit and offset
+func (h *Handler) parseArticleQuery(r *http.Request) (models.ArticleQuery, models.ValidationMessages) {
+	r.ParseForm()
+	queryParams := r.Form
+	errs := models.ValidationMessages{}
+
+	query := models.ArticleQuery{
+		Author:         queryParams.Get("author"),
+		FavoritedBy:    queryParams.Get("favorited"),
+		Sort:           queryParams.Get("sort"),
+		TrendingWindow: h.TrendingWindow,
+		Limit:          20,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	for _, tag := range queryParams["tag"] {
+		if strings.HasPrefix(tag, "-") {
+			query.ExcludedTags = append(query.ExcludedTags, tag[1:])
+		} else if tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
+	}
 
-	if len(articles) == 0 {
-		json.NewEncoder(w).Encode(ArticlesJSON{})
-		return
+	switch queryParams.Get("tagMatch") {
+	case "", "any":
+	case "all":
+		query.AllTags = true
+	default:
+		errs["tagMatch"] = []string{"tagMatch must be one of any, all"}
 	}
 
-	var u = &models.User{}
-	if claim, _ := h.JWT.CheckRequest(r); claim != nil {
-		u, err = h.DB.FindUserByUsername(claim.Username)
+	if !models.IsValidSort(query.Sort) {
+		errs["sort"] = []string{fmt.Sprintf("sort must be one of %s", strings.Join(models.Sorts, ", "))}
 	}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+	for _, param := range []string{"since", "until"} {
+		v := queryParams.Get(param)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err == nil && param == "until" {
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		if err != nil {
+			errs[param] = []string{fmt.Sprintf("%s must be an RFC 3339 time or a date", param)}
+			continue
+		}
+
+		if param == "since" {
+			query.Since = t
+		} else {
+			query.Until = t
+		}
 	}
 
-	var articlesJSON ArticlesJSON
-	for i := range articles {
-		a := &articles[i]
-		articlesJSON.Articles = append(articlesJSON.Articles, h.buildArticleJSON(a, u))
+	if limit, err := strconv.Atoi(queryParams.Get("limit")); err == nil && limit > 0 {
+		query.Limit = limit
 	}
 
-	articlesJSON.ArticlesCount = len(articles)
+	if offset, err := strconv.Atoi(queryParams.Get("offset")); err == nil && offset > 0 {
+		query.Offset = offset
+	}
 
-	json.NewEncoder(w).Encode(articlesJSON)
+	return query, errs
 }
 
 // createArticle handle POST /api/articles
 func (h *Handler) createArticle(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		Article struct {
-			Title       string   `json:"title"`
-			Description string   `json:"description"`
-			Body        string   `json:"body"`
-			TagsList    []string `json:"tagsList"`
+			Title       string     `json:"title"`
+			Description string     `json:"description"`
+			Body        string     `json:"body"`
+			TagsList    []string   `json:"tagsList"`
+			Status      string     `json:"status"`
+			PublishAt   *time.Time `json:"publishAt"`
 		} `json:"article"`
 	}
 
@@ -240,6 +345,10 @@ func (h *Handler) createArticle(w http.ResponseWriter, r *http.Request) {
 	u := r.Context().Value(CurrentUser).(*models.User)
 
 	a := models.NewArticle(body.Article.Title, body.Article.Description, body.Article.Body, u)
+	a.PublishAt = body.Article.PublishAt
+	if body.Article.Status != "" {
+		a.Status = body.Article.Status
+	}
 
 	if valid, errs := a.IsValid(); !valid {
 		w.Header().Set("Content-Type", "application/json")
@@ -249,18 +358,39 @@ func (h *Handler) createArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, tagName := range body.Article.TagsList {
-		tag, _ := h.DB.FindTagOrInit(tagName)
-		a.Tags = append(a.Tags, tag)
-	}
+	err := models.RetryOnConflict(3, func() error {
+		return h.store(r).WithTx(func(tx models.Datastorer) error {
+			a.ID = 0
+			a.Tags = nil
+			seen := make(map[uint]bool)
+			for _, tagName := range body.Article.TagsList {
+				if models.NormalizeTagName(tagName) == "" {
+					continue
+				}
+
+				// Names normalizing or aliased to the same tag are only kept once
+				tag, err := tx.FindOrCreateTag(tagName)
+				if err != nil {
+					return err
+				}
+				if !seen[tag.ID] {
+					seen[tag.ID] = true
+					a.Tags = append(a.Tags, tag)
+				}
+			}
+
+			return tx.CreateArticle(a)
+		})
+	})
 
-	if err := h.DB.CreateArticle(a); err != nil {
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.Metrics.ArticlesCreated.Inc()
 
 	articleJSON := ArticleJSON{
-		Article: h.buildArticleJSON(a, u),
+		Article: h.buildArticleJSON(r, a, u),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -280,6 +410,10 @@ func (h *Handler) updateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkIfMatch(w, r, a.Version) {
+		return
+	}
+
 	var body map[string]map[string]interface{}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -310,8 +444,24 @@ func (h *Handler) updateArticle(w http.ResponseWriter, r *http.Request) {
 		a.Body = body.(string)
 	}
 
+	if status, present := article["status"]; present {
+		a.Status, _ = status.(string)
+	}
+
+	if publishAt, present := article["publishAt"]; present {
+		a.PublishAt = nil
+		if v, _ := publishAt.(string); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			a.PublishAt = &t
+		}
+	}
+
 	if valid, errs := a.IsValid(); !valid {
-		h.Logger.Println(errs)
+		h.log(r).Debug("invalid article", "errors", errs)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnprocessableEntity)
 		errorResponse := errorResponse{Errors: errs}
@@ -319,16 +469,20 @@ func (h *Handler) updateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.DB.SaveArticle(a); err != nil {
+	if err := h.store(r).SaveArticle(a); err == models.ErrVersionConflict {
+		http.Error(w, err.Error(), versionConflictStatus(r))
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	articleJSON := ArticleJSON{
-		Article: h.buildArticleJSON(a, u),
+		Article: h.buildArticleJSON(r, a, u),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", articleETag(articleJSON.Article))
 	w.WriteHeader(http.StatusOK)
 
 	json.NewEncoder(w).Encode(articleJSON)
@@ -346,7 +500,16 @@ func (h *Handler) deleteArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.DB.DeleteArticle(a)
+	if !checkIfMatch(w, r, a.Version) {
+		return
+	}
+
+	err = h.store(r).DeleteArticle(a)
+
+	if err == models.ErrVersionConflict {
+		http.Error(w, err.Error(), versionConflictStatus(r))
+		return
+	}
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -356,15 +519,62 @@ func (h *Handler) deleteArticle(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// restoreArticle handle POST /api/articles/:slug/restore
+func (h *Handler) restoreArticle(w http.ResponseWriter, r *http.Request) {
+	u := r.Context().Value(CurrentUser).(*models.User)
+	slug, _ := r.Context().Value("slug").(string)
+
+	a, err := h.store(r).GetDeletedArticle(slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !a.IsOwnedBy(u.Username) {
+		err = fmt.Errorf("You don't have the permission to restore this article")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if time.Since(*a.DeletedAt) > h.RestoreWindow {
+		err = fmt.Errorf("This article was deleted too long ago to be restored")
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+
+	if err = h.store(r).RestoreArticle(a); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	articleJSON := ArticleJSON{
+		Article: h.buildArticleJSON(r, a, u),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", articleETag(articleJSON.Article))
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(articleJSON)
+}
+
 // favoriteArticle handle POST /api/articles/:slug/favorite
 func (h *Handler) favoriteArticle(w http.ResponseWriter, r *http.Request) {
 	a := r.Context().Value(FetchedArticle).(*models.Article)
 	u := r.Context().Value(CurrentUser).(*models.User)
 
-	err := h.DB.FavoriteArticle(u.ID, a.ID)
+	err := h.store(r).FavoriteArticle(u.ID, a.ID)
+	if err == nil {
+		h.Metrics.Favorites.Inc()
+	}
+
+	// Render the article as it is after the change
+	if updated, getErr := h.store(r).GetArticle(a.Slug); getErr == nil {
+		a = updated
+	}
 
 	articleJSON := ArticleJSON{
-		Article: h.buildArticleJSON(a, u),
+		Article: h.buildArticleJSON(r, a, u),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -383,10 +593,15 @@ func (h *Handler) unFavoriteArticle(w http.ResponseWriter, r *http.Request) {
 	a := r.Context().Value(FetchedArticle).(*models.Article)
 	u := r.Context().Value(CurrentUser).(*models.User)
 
-	err := h.DB.UnfavoriteArticle(u.ID, a.ID)
+	err := h.store(r).UnfavoriteArticle(u.ID, a.ID)
+
+	// Render the article as it is after the change
+	if updated, getErr := h.store(r).GetArticle(a.Slug); getErr == nil {
+		a = updated
+	}
 
 	articleJSON := ArticleJSON{
-		Article: h.buildArticleJSON(a, u),
+		Article: h.buildArticleJSON(r, a, u),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -400,22 +615,61 @@ func (h *Handler) unFavoriteArticle(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(articleJSON)
 }
 
-func (h *Handler) buildArticleJSON(a *models.Article, u *models.User) Article {
+func (h *Handler) buildArticleJSON(r *http.Request, a *models.Article, u *models.User) Article {
 	following := false
 	favorited := false
 
-	if (u != &models.User{}) {
-		following = h.DB.IsFollowing(u.ID, a.User.ID)
-		favorited = h.DB.IsFavorited(u.ID, a.ID)
+	if u.ID != 0 {
+		following = h.store(r).IsFollowing(u.ID, a.User.ID)
+		favorited = h.store(r).IsFavorited(u.ID, a.ID)
+	}
+
+	return h.renderArticle(a, favorited, following)
+}
+
+// buildArticlesJSON renders a list of articles, looking up what the user
+// favorited and follows with one query each whatever the list length
+func (h *Handler) buildArticlesJSON(r *http.Request, articles []models.Article, u *models.User) ([]Article, error) {
+	var articleIDs, authorIDs []int
+	for i := range articles {
+		articleIDs = append(articleIDs, articles[i].ID)
+		authorIDs = append(authorIDs, articles[i].User.ID)
+	}
+
+	favorited, err := h.store(r).FavoritedArticleIDs(u.ID, articleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	following, err := h.store(r).FollowedUserIDs(u.ID, authorIDs)
+	if err != nil {
+		return nil, err
 	}
 
+	var res []Article
+	for i := range articles {
+		a := &articles[i]
+		res = append(res, h.renderArticle(a, favorited[a.ID], following[a.User.ID]))
+	}
+
+	return res, nil
+}
+
+func (h *Handler) renderArticle(a *models.Article, favorited bool, following bool) Article {
 	article := Article{
 		Slug:           a.Slug,
 		Title:          a.Title,
 		Description:    a.Description,
 		Body:           a.Body,
+		BodyHTML:       h.renderMarkdown(revisionKey(a.ID, a.Revision), a.Body),
 		Favorited:      favorited,
 		FavoritesCount: a.FavoritesCount,
+		CreatedAt:      a.CreatedAt,
+		UpdatedAt:      a.UpdatedAt,
+		Status:         a.Status,
+		PublishAt:      a.PublishAt,
+		PublishedAt:    a.PublishedAt,
+		Version:        a.Version,
 		Author: Author{
 			Username:  a.User.Username,
 			Bio:       a.User.Bio,
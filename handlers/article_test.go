@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/JackyChiu/realworld-starter-kit/auth"
 	"github.com/JackyChiu/realworld-starter-kit/models"
@@ -26,32 +28,22 @@ type article struct {
 	TagsList    []string `json:"tagsList"`
 }
 
-var (
-	h *Handler
-)
-
-func TestMain(m *testing.M) {
-	logger := log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
-
-	db, err := models.NewDB("sqlite3", "../conduit_test.db")
-	if err != nil {
-		logger.Fatal(err)
+// newTestHandler returns a Handler backed by its own seeded in-memory
+// store, so tests can run in parallel without sharing state.
+func newTestHandler(t *testing.T) *Handler {
+	db := models.NewMemoryStore()
+	if err := models.SeedStore(db); err != nil {
+		t.Fatal(err)
 	}
-	//db.LogMode(true)
-	db.InitSchema()
-	db.Seed()
-
-	j := auth.NewJWT()
-	h = New(db, j, logger)
 
-	exit := m.Run()
-
-	db.CleanDatabase()
-
-	os.Exit(exit)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	return New(db, auth.NewJWT(), logger)
 }
 
 func TestArticlesHandler_Index(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("GET", "/api/articles", nil)
 	if err != nil {
 		t.Fatal(err)
@@ -88,6 +80,9 @@ func TestArticlesHandler_Index(t *testing.T) {
 }
 
 func TestArticlesHandler_Read(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("GET", "/api/articles/title-5", nil)
 
 	if err != nil {
@@ -120,6 +115,9 @@ func TestArticlesHandler_Read(t *testing.T) {
 }
 
 func TestArticlesHandler_FilterByTag(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("GET", "/api/articles?tag=tag1", nil)
 
 	if err != nil {
@@ -148,6 +146,9 @@ func TestArticlesHandler_FilterByTag(t *testing.T) {
 }
 
 func TestArticlesHandler_FilterByAuthor(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("GET", "/api/articles?author=user1", nil)
 
 	if err != nil {
@@ -176,6 +177,9 @@ func TestArticlesHandler_FilterByAuthor(t *testing.T) {
 }
 
 func TestArticlesHandler_FilterByFavorited(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("GET", "/api/articles?favorited=user1", nil)
 
 	if err != nil {
@@ -204,6 +208,9 @@ func TestArticlesHandler_FilterByFavorited(t *testing.T) {
 }
 
 func TestArticlesHandler_CreateUnauthorized(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	a := Article{
 		Title:       "GoLang Web Services",
 		Description: "GoLang Web Services description",
@@ -229,6 +236,9 @@ func TestArticlesHandler_CreateUnauthorized(t *testing.T) {
 }
 
 func TestArticlesHandler_Create(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	a := articleEntity{
 		Article: article{
 			Title:       "GoLang Web Services",
@@ -266,6 +276,9 @@ func TestArticlesHandler_Create(t *testing.T) {
 }
 
 func TestArticlesHandler_CreateWithEmptyTitle(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	a := articleEntity{
 		Article: article{
 			Title:       "",
@@ -303,6 +316,9 @@ func TestArticlesHandler_CreateWithEmptyTitle(t *testing.T) {
 }
 
 func TestArticlesHandler_CreateWithEmptyDescription(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	a := articleEntity{
 		Article: article{
 			Title:       "GoLang Web Services",
@@ -340,6 +356,9 @@ func TestArticlesHandler_CreateWithEmptyDescription(t *testing.T) {
 }
 
 func TestArticlesHandler_CreateWithEmptyBody(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	a := articleEntity{
 		Article: article{
 			Title:       "GoLang Web Services",
@@ -377,6 +396,9 @@ func TestArticlesHandler_CreateWithEmptyBody(t *testing.T) {
 }
 
 func TestArticlesHandler_UpdateWrongOwner(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	jsonBody, _ := json.Marshal(map[string]interface{}{
 		"article": map[string]string{
 			"title": "Title Should Not Be Updated",
@@ -402,6 +424,9 @@ func TestArticlesHandler_UpdateWrongOwner(t *testing.T) {
 }
 
 func TestArticlesHandler_UpdateNotAuthorized(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	jsonBody, _ := json.Marshal(map[string]interface{}{
 		"article": map[string]string{
 			"title": "Title Should Not Be Updated",
@@ -424,6 +449,9 @@ func TestArticlesHandler_UpdateNotAuthorized(t *testing.T) {
 }
 
 func TestArticlesHandler_UpdateOK(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	updatedTitle := "Title Should Be Updated"
 	jsonBody, _ := json.Marshal(map[string]interface{}{
 		"article": map[string]string{
@@ -463,6 +491,9 @@ func TestArticlesHandler_UpdateOK(t *testing.T) {
 }
 
 func TestArticlesHandler_Favorite(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("POST", "/api/articles/title-2/favorite", nil)
 
 	if err != nil {
@@ -487,9 +518,21 @@ func TestArticlesHandler_Favorite(t *testing.T) {
 	if articleResponse.Article.Favorited != true {
 		t.Errorf("article should be in the state favorited: got %v wamt %v", articleResponse.Article.Favorited, true)
 	}
+	if count := articleResponse.Article.FavoritesCount; count != 2 {
+		t.Errorf("should return the updated favorites count: got %v wamt %v", count, 2)
+	}
 }
 
 func TestArticlesHandler_FavoriteTwice(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	u, _ := h.DB.FindUserByUsername("user1")
+	a, _ := h.DB.GetArticle("title-2")
+	if err := h.DB.FavoriteArticle(u.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
 	req, err := http.NewRequest("POST", "/api/articles/title-2/favorite", nil)
 
 	if err != nil {
@@ -517,6 +560,9 @@ func TestArticlesHandler_FavoriteTwice(t *testing.T) {
 }
 
 func TestArticlesHandler_Unfavorite(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("DELETE", "/api/articles/title-2/favorite", nil)
 
 	if err != nil {
@@ -541,9 +587,21 @@ func TestArticlesHandler_Unfavorite(t *testing.T) {
 	if articleResponse.Article.Favorited != false {
 		t.Errorf("article should be in the state unfavorited: got %v wamt %v", articleResponse.Article.Favorited, false)
 	}
+	if count := articleResponse.Article.FavoritesCount; count != 0 {
+		t.Errorf("should return the updated favorites count: got %v wamt %v", count, 0)
+	}
 }
 
 func TestArticlesHandler_UnfavoriteTwice(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	u, _ := h.DB.FindUserByUsername("user2")
+	a, _ := h.DB.GetArticle("title-2")
+	if err := h.DB.UnfavoriteArticle(u.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
 	req, err := http.NewRequest("DELETE", "/api/articles/title-2/favorite", nil)
 
 	if err != nil {
@@ -571,6 +629,9 @@ func TestArticlesHandler_UnfavoriteTwice(t *testing.T) {
 }
 
 func TestArticlesHandler_DeleteOk(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	u, _ := h.DB.FindUserByUsername("user1")
 	a := models.NewArticle("To Be Deleted", "Description", "Body", u)
 	err := h.DB.CreateArticle(a)
@@ -599,6 +660,9 @@ func TestArticlesHandler_DeleteOk(t *testing.T) {
 }
 
 func TestArticlesHandler_DeleteWrongOwner(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	u, _ := h.DB.FindUserByUsername("user1")
 	a := models.NewArticle("Should Not Be Deleted", "Description", "Body", u)
 	err := h.DB.CreateArticle(a)
@@ -627,6 +691,9 @@ func TestArticlesHandler_DeleteWrongOwner(t *testing.T) {
 }
 
 func TestArticlesHandler_DeleteUnaithorized(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
 	req, err := http.NewRequest("DELETE", "/api/articles/title-5", nil)
 
 	if err != nil {
@@ -642,3 +709,386 @@ func TestArticlesHandler_DeleteUnaithorized(t *testing.T) {
 		t.Errorf("should get a 401 status code: got %v wamt %v", Code, http.StatusUnauthorized)
 	}
 }
+
+func TestArticlesHandler_Restore(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		window   time.Duration
+		code     int
+	}{
+		{"Ok", "user1", DefaultRestoreWindow, http.StatusOK},
+		{"WrongOwner", "user2", DefaultRestoreWindow, http.StatusForbidden},
+		{"Expired", "user1", 0, http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newTestHandler(t)
+			h.RestoreWindow = tt.window
+
+			a, _ := h.DB.GetArticle("title-1")
+			h.DB.DeleteArticle(a)
+
+			req, err := http.NewRequest("POST", "/api/articles/title-1/restore", nil)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jwt := auth.NewJWT().NewToken(tt.username)
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+			// A write is never answered with a 304
+			req.Header.Set("If-None-Match", "*")
+
+			recorder := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.ArticlesHandler)
+
+			handler.ServeHTTP(recorder, req)
+
+			if Code := recorder.Code; Code != tt.code {
+				t.Errorf("should get a %v status code: got %v wamt %v", tt.code, Code, tt.code)
+			}
+			if tt.code == http.StatusOK && recorder.Header().Get("ETag") == "" {
+				t.Errorf("should return the ETag of the restored article")
+			}
+
+			_, err = h.DB.GetArticle("title-1")
+			if restored := err == nil; restored != (tt.code == http.StatusOK) {
+				t.Errorf("article should be restored only on success: got %v", restored)
+			}
+		})
+	}
+}
+
+func TestArticlesHandler_DraftVisibility(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	u, _ := h.DB.FindUserByUsername("user1")
+	a := models.NewArticle("My Draft", "Description", "Body", u)
+	a.Status = models.StatusDraft
+	if err := h.DB.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		code     int
+		listed   bool
+	}{
+		{"", http.StatusNotFound, false},
+		{"user2", http.StatusNotFound, false},
+		{"user1", http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/api/articles/my-draft", nil)
+		if tt.username != "" {
+			jwt := auth.NewJWT().NewToken(tt.username)
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+		}
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		if Code := recorder.Code; Code != tt.code {
+			t.Errorf("%q should get a %v status code: got %v", tt.username, tt.code, Code)
+		}
+
+		req, _ = http.NewRequest("GET", "/api/articles", nil)
+		if tt.username != "" {
+			jwt := auth.NewJWT().NewToken(tt.username)
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+		}
+
+		recorder = httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		var articles ArticlesJSON
+		json.NewDecoder(recorder.Body).Decode(&articles)
+
+		listed := false
+		for _, a := range articles.Articles {
+			listed = listed || a.Slug == "my-draft"
+		}
+
+		if listed != tt.listed {
+			t.Errorf("%q should see the draft listed %v: got %v", tt.username, tt.listed, listed)
+		}
+	}
+}
+
+func TestArticlesHandler_CreateScheduled(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"article": map[string]interface{}{
+			"title":       "Coming Soon",
+			"description": "Description",
+			"body":        "Body",
+			"status":      models.StatusScheduled,
+			"publishAt":   time.Now().Add(time.Hour),
+		},
+	})
+	req, err := http.NewRequest("POST", "/api/articles", bytes.NewBuffer(jsonBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := auth.NewJWT().NewToken("user1")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusCreated {
+		t.Errorf("should return a 201 status code: got %v wamt %v", Code, http.StatusCreated)
+	}
+
+	var articleResponse ArticleJSON
+	json.NewDecoder(recorder.Body).Decode(&articleResponse)
+
+	if a := articleResponse.Article; a.Status != models.StatusScheduled || a.PublishAt == nil || a.PublishedAt != nil {
+		t.Errorf("should return a scheduled article: got %v %v %v", a.Status, a.PublishAt, a.PublishedAt)
+	}
+}
+
+func TestArticlesHandler_CreateScheduledWithoutDate(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"article": map[string]interface{}{
+			"title":       "Coming Soon",
+			"description": "Description",
+			"body":        "Body",
+			"status":      models.StatusScheduled,
+		},
+	})
+	req, err := http.NewRequest("POST", "/api/articles", bytes.NewBuffer(jsonBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := auth.NewJWT().NewToken("user1")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusUnprocessableEntity {
+		t.Errorf("should return a 422 status code: got %v wamt %v", Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestArticlesHandler_BodyHTML(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	u, _ := h.DB.FindUserByUsername("user1")
+	a := models.NewArticle("Markdown", "Description", "Some *emphasis*<img src=x onerror=alert(1)>", u)
+	if err := h.DB.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() Article {
+		req, _ := http.NewRequest("GET", "/api/articles/markdown", nil)
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		var articleResponse ArticleJSON
+		json.NewDecoder(recorder.Body).Decode(&articleResponse)
+		return articleResponse.Article
+	}
+
+	if html := get().BodyHTML; html != "<p>Some <em>emphasis</em></p>\n" {
+		t.Errorf("should render the sanitized body: got %q", html)
+	}
+
+	a.Body = "**Updated**"
+	if err := h.DB.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if html := get().BodyHTML; html != "<p><strong>Updated</strong></p>\n" {
+		t.Errorf("should render the latest revision: got %q", html)
+	}
+}
+
+func TestArticlesHandler_Sort(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	u, _ := h.DB.FindUserByUsername("user2")
+	a, _ := h.DB.GetArticle("title-1")
+	if err := h.DB.FavoriteArticle(u.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort  string
+		code  int
+		first string
+	}{
+		{"", http.StatusOK, "title-5"},
+		{"oldest", http.StatusOK, "title-1"},
+		{"most-favorited", http.StatusOK, "title-1"},
+		{"trending", http.StatusOK, "title-1"},
+		{"random", http.StatusUnprocessableEntity, ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/api/articles?sort="+tt.sort, nil)
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		if Code := recorder.Code; Code != tt.code {
+			t.Errorf("sort=%s should return a %v status code: got %v", tt.sort, tt.code, Code)
+			continue
+		}
+
+		if tt.code != http.StatusOK {
+			var errorResponse errorResponse
+			json.NewDecoder(recorder.Body).Decode(&errorResponse)
+			if _, present := errorResponse.Errors["sort"]; !present {
+				t.Errorf("sort=%s should return an error for the sort field", tt.sort)
+			}
+			continue
+		}
+
+		var articles ArticlesJSON
+		json.NewDecoder(recorder.Body).Decode(&articles)
+
+		if len(articles.Articles) == 0 || articles.Articles[0].Slug != tt.first {
+			t.Errorf("sort=%s should list %s first: got %+v", tt.sort, tt.first, articles.Articles)
+		}
+	}
+}
+
+func TestArticlesHandler_Filters(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	u, _ := h.DB.FindUserByUsername("user1")
+	a := models.NewArticle("Multi", "Description", "Body", u)
+	for _, name := range []string{"tag0", "tag3"} {
+		tag, _ := h.DB.FindOrCreateTag(name)
+		a.Tags = append(a.Tags, tag)
+	}
+	if err := h.DB.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		query string
+		code  int
+		slugs []string
+	}{
+		{"tag=tag0&tag=tag3", http.StatusOK, []string{"multi", "title-2", "title-1"}},
+		{"tag=tag0&tag=TAG3&tagMatch=any", http.StatusOK, []string{"multi", "title-2", "title-1"}},
+		{"tag=tag0&tag=tag3&tagMatch=all", http.StatusOK, []string{"multi"}},
+		{"tag=tag0&tag=-tag3", http.StatusOK, []string{"title-1"}},
+		{"tag=-tag0&tag=-tag6", http.StatusOK, []string{"title-5", "title-4", "title-2"}},
+		{"tag=tag3&author=user1", http.StatusOK, []string{"multi"}},
+		{"tag=tag3&favorited=user2", http.StatusOK, []string{"title-2"}},
+		{"tag=tag0&tagMatch=all&since=2000-01-01", http.StatusOK, []string{"multi", "title-1"}},
+		{"since=" + future, http.StatusOK, nil},
+		{"until=2000-01-01", http.StatusOK, nil},
+		{"until=" + future + "&tag=tag3", http.StatusOK, []string{"multi", "title-2"}},
+		{"tagMatch=some", http.StatusUnprocessableEntity, nil},
+		{"since=yesterday", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/api/articles?"+tt.query, nil)
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		if Code := recorder.Code; Code != tt.code {
+			t.Errorf("%s should return a %v status code: got %v", tt.query, tt.code, Code)
+			continue
+		}
+
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		var articles ArticlesJSON
+		json.NewDecoder(recorder.Body).Decode(&articles)
+
+		var slugs []string
+		for _, a := range articles.Articles {
+			slugs = append(slugs, a.Slug)
+		}
+
+		if fmt.Sprint(slugs) != fmt.Sprint(tt.slugs) {
+			t.Errorf("%s should return %v: got %v", tt.query, tt.slugs, slugs)
+		}
+	}
+}
+
+// countingStore counts the per-article lookups made by the handlers
+type countingStore struct {
+	models.Datastorer
+	mu      sync.Mutex
+	lookups int
+}
+
+func (s *countingStore) IsFavorited(userID int, articleID int) bool {
+	s.mu.Lock()
+	s.lookups++
+	s.mu.Unlock()
+	return s.Datastorer.IsFavorited(userID, articleID)
+}
+
+func (s *countingStore) IsFollowing(userIDFrom int, userIDTo int) bool {
+	s.mu.Lock()
+	s.lookups++
+	s.mu.Unlock()
+	return s.Datastorer.IsFollowing(userIDFrom, userIDTo)
+}
+
+func TestArticlesHandler_IndexBatchesLookups(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+	store := &countingStore{Datastorer: h.DB}
+	h.DB = store
+
+	req, err := http.NewRequest("GET", "/api/articles", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := auth.NewJWT().NewToken("user1")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	var articles ArticlesJSON
+	json.NewDecoder(recorder.Body).Decode(&articles)
+
+	if store.lookups != 0 {
+		t.Errorf("should not look up each article: got %v lookups wamt %v", store.lookups, 0)
+	}
+
+	for _, a := range articles.Articles {
+		if favorited := a.Author.Username == "user1"; a.Favorited != favorited {
+			t.Errorf("%v should be in the state favorited %v: got %v", a.Slug, favorited, a.Favorited)
+		}
+	}
+}
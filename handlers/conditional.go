@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache-Control of article reads. Anonymous responses are the same for
+// everyone and can be kept by shared caches for a minute, responses to
+// authenticated requests carry viewer dependent fields and are private.
+// Both must be revalidated by browsers, which the ETag makes cheap.
+const (
+	PublicCacheControl  = "public, max-age=0, s-maxage=60"
+	PrivateCacheControl = "private, no-cache"
+)
+
+// articlesETag returns a strong ETag of articles as seen by the viewer. It
+// is derived from what identifies a version of each article and from the
+// viewer dependent fields rather than from the encoded body.
+func articlesETag(articles ...Article) string {
+	return fmt.Sprintf(`"%s"`, hashArticles(articles...))
+}
+
+// articleETag returns the ETag of a single article, prefixed with its
+// version so If-Match can be checked against the stored version
+func articleETag(a Article) string {
+	return fmt.Sprintf(`"%d-%s"`, a.Version, hashArticles(a))
+}
+
+func hashArticles(articles ...Article) string {
+	h := sha256.New()
+	for _, a := range articles {
+		// Merging tags renames them without changing the articles version
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\x00%s\x00%s\x00%t\x00%s\x00%s\x00%s\x00%t\n",
+			a.Slug, a.Version, a.UpdatedAt.UnixNano(), a.FavoritesCount, a.Status,
+			strings.Join(a.TagsList, "\x01"), a.Favorited,
+			a.Author.Username, a.Author.Bio, a.Author.Image, a.Author.Following)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:16])
+}
+
+// lastModified returns the latest modification time of the articles,
+// publishing a scheduled article doesn't update it
+func lastModified(articles ...Article) time.Time {
+	var t time.Time
+	for _, a := range articles {
+		if a.UpdatedAt.After(t) {
+			t = a.UpdatedAt
+		}
+		if a.PublishedAt != nil && a.PublishedAt.After(t) {
+			t = *a.PublishedAt
+		}
+	}
+	return t
+}
+
+// checkNotModified sets the validators and caching headers of a GET
+// response. It writes a 304 and returns true when the request conditions
+// show the client already has this representation.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	header := w.Header()
+	header.Set("ETag", etag)
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	header.Add("Vary", "Authorization")
+	if r.Header.Get("Authorization") == "" {
+		header.Set("Cache-Control", PublicCacheControl)
+	} else {
+		header.Set("Cache-Control", PrivateCacheControl)
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is sent, RFC 7232 6
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag, true) {
+			return false
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err != nil ||
+		modified.IsZero() || modified.Truncate(time.Second).After(ims) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch enforces the If-Match header of a request changing an
+// article. It writes a 412 and returns false when none of the listed ETags
+// is of the article current version.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" {
+			return true
+		}
+
+		// Weak ETags never match with If-Match, RFC 7232 3.1
+		if strings.HasPrefix(etag, "W/") {
+			continue
+		}
+
+		v := strings.SplitN(strings.Trim(etag, `"`), "-", 2)[0]
+		if n, err := strconv.Atoi(v); err == nil && n == version {
+			return true
+		}
+	}
+
+	http.Error(w, "The article was changed since it was read", http.StatusPreconditionFailed)
+	return false
+}
+
+// versionConflictStatus is the status of a save failing because the
+// article changed meanwhile: the precondition failed when the client sent
+// one, otherwise it conflicts with the concurrent change
+func versionConflictStatus(r *http.Request) int {
+	if r.Header.Get("If-Match") != "" {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value
+// lists etag. The weak comparison ignores the W/ prefix.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
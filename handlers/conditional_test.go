@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+)
+
+func TestArticlesHandler_ConditionalGet(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for _, url := range []string{"/api/articles/title-1", "/api/articles?tag=tag0"} {
+		recorder := get(url, nil)
+
+		etag := recorder.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("%s should return an ETag", url)
+		}
+
+		if lm := recorder.Header().Get("Last-Modified"); lm == "" {
+			t.Errorf("%s should return a Last-Modified header", url)
+		}
+
+		if v := recorder.Header().Get("Vary"); v != "Authorization" {
+			t.Errorf("%s should vary on Authorization: got %q", url, v)
+		}
+
+		if cc := recorder.Header().Get("Cache-Control"); cc != PublicCacheControl {
+			t.Errorf("%s should be cacheable by shared caches: got %q", url, cc)
+		}
+
+		recorder = get(url, http.Header{"If-None-Match": {etag}})
+		if Code := recorder.Code; Code != http.StatusNotModified {
+			t.Errorf("%s should return a 304 status code for a matching ETag: got %v", url, Code)
+		}
+
+		if recorder.Body.Len() != 0 {
+			t.Errorf("%s should not return a body with a 304: got %q", url, recorder.Body.String())
+		}
+
+		recorder = get(url, http.Header{"If-None-Match": {`"other", W/` + etag}})
+		if Code := recorder.Code; Code != http.StatusNotModified {
+			t.Errorf("%s should match an ETag in a list: got %v", url, Code)
+		}
+
+		recorder = get(url, http.Header{"If-None-Match": {`"other"`}})
+		if Code := recorder.Code; Code != http.StatusOK {
+			t.Errorf("%s should return a 200 status code for another ETag: got %v", url, Code)
+		}
+
+		future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		recorder = get(url, http.Header{"If-Modified-Since": {future}})
+		if Code := recorder.Code; Code != http.StatusNotModified {
+			t.Errorf("%s should return a 304 status code when not modified since: got %v", url, Code)
+		}
+
+		past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+		recorder = get(url, http.Header{"If-Modified-Since": {past}})
+		if Code := recorder.Code; Code != http.StatusOK {
+			t.Errorf("%s should return a 200 status code when modified since: got %v", url, Code)
+		}
+
+		recorder = get(url, http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {future}})
+		if Code := recorder.Code; Code != http.StatusOK {
+			t.Errorf("%s should ignore If-Modified-Since with If-None-Match: got %v", url, Code)
+		}
+	}
+}
+
+func TestArticlesHandler_ETagChanges(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	get := func(username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/articles/title-2", nil)
+		if username != "" {
+			jwt := auth.NewJWT().NewToken(username)
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+		}
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	anonymous := get("").Header().Get("ETag")
+
+	recorder := get("user2")
+	if cc := recorder.Header().Get("Cache-Control"); cc != PrivateCacheControl {
+		t.Errorf("should keep authenticated responses private: got %q", cc)
+	}
+
+	// user2 favorited its own article
+	if etag := recorder.Header().Get("ETag"); etag == anonymous {
+		t.Errorf("should change the ETag with the viewer dependent fields")
+	}
+
+	u, _ := h.DB.FindUserByUsername("user1")
+	a, _ := h.DB.GetArticle("title-2")
+	if err := h.DB.FavoriteArticle(u.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	favorited := get("").Header().Get("ETag")
+	if favorited == anonymous {
+		t.Errorf("should change the ETag when the favorites count changes")
+	}
+
+	if _, err := h.DB.MergeTags("tag3", "tag4"); err != nil {
+		t.Fatal(err)
+	}
+
+	if etag := get("").Header().Get("ETag"); etag == favorited {
+		t.Errorf("should change the ETag when the tags change")
+	}
+}
+
+func TestArticlesHandler_IfMatch(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+	jwt := auth.NewJWT().NewToken("user1")
+
+	do := func(method string, url string, body string, ifMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	stale := do("GET", "/api/articles/title-1", "", "").Header().Get("ETag")
+	if !strings.HasPrefix(stale, `"1-`) {
+		t.Fatalf("should prefix the ETag with the version: got %v", stale)
+	}
+
+	update := `{"article":{"body":"Updated"}}`
+	recorder := do("PUT", "/api/articles/title-1", update, stale)
+	if Code := recorder.Code; Code != http.StatusOK {
+		t.Fatalf("should return a 200 status code for a matching If-Match: got %v wamt %v", Code, http.StatusOK)
+	}
+
+	current := recorder.Header().Get("ETag")
+	if !strings.HasPrefix(current, `"2-`) {
+		t.Errorf("should return the ETag of the new version: got %v", current)
+	}
+
+	recorder = do("PUT", "/api/articles/title-1", update, stale)
+	if Code := recorder.Code; Code != http.StatusPreconditionFailed {
+		t.Errorf("should return a 412 status code for a stale If-Match: got %v wamt %v", Code, http.StatusPreconditionFailed)
+	}
+
+	recorder = do("PUT", "/api/articles/title-1", update, "W/"+current)
+	if Code := recorder.Code; Code != http.StatusPreconditionFailed {
+		t.Errorf("should not match a weak ETag: got %v wamt %v", Code, http.StatusPreconditionFailed)
+	}
+
+	recorder = do("DELETE", "/api/articles/title-1", "", stale)
+	if Code := recorder.Code; Code != http.StatusPreconditionFailed {
+		t.Errorf("should not delete with a stale If-Match: got %v wamt %v", Code, http.StatusPreconditionFailed)
+	}
+
+	recorder = do("DELETE", "/api/articles/title-1", "", `"other", `+current)
+	if Code := recorder.Code; Code != http.StatusNoContent {
+		t.Errorf("should delete with a matching If-Match: got %v wamt %v", Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig lists what cross origin requests may do
+type CORSConfig struct {
+	// AllowedOrigins are the allowed origins, like https://example.com, or
+	// "*" for any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed besides the CORS
+	// safelisted ones, or "*" for any header
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers readable by the client
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and read the responses
+	// of credentialed requests. The origin is then echoed instead of "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// DefaultCORSConfig allows any origin to use the API with a token in the
+// Authorization header
+var DefaultCORSConfig = CORSConfig{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+	AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-Requested-With"},
+	ExposedHeaders: []string{"ETag", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"},
+	MaxAge:         10 * time.Minute,
+}
+
+// CORS adds the CORS headers to the responses of next and answers the
+// preflight requests itself, so it must wrap the routers. Requests from
+// other origins are passed on without CORS headers, browsers then keep
+// their responses from the page.
+func CORS(c CORSConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		header := w.Header()
+
+		preflight := r.Method == "OPTIONS" && origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Origin")
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		} else if !c.allowsAnyOrigin() || c.AllowCredentials {
+			header.Add("Vary", "Origin")
+		}
+
+		if origin == "" || !c.allowsOrigin(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.allowsAnyOrigin() && !c.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(c.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !contains(c.AllowedMethods, method, false) {
+			http.Error(w, "Method not allowed", http.StatusForbidden)
+			return
+		}
+
+		var headers []string
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			h = strings.TrimSpace(h)
+			if h == "" {
+				continue
+			}
+			if !contains(c.AllowedHeaders, h, true) && !contains(c.AllowedHeaders, "*", false) {
+				http.Error(w, "Header not allowed: "+h, http.StatusForbidden)
+				return
+			}
+			headers = append(headers, h)
+		}
+
+		header.Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+		if len(headers) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		}
+		if c.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c CORSConfig) allowsAnyOrigin() bool {
+	return contains(c.AllowedOrigins, "*", false)
+}
+
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	return c.allowsAnyOrigin() || contains(c.AllowedOrigins, origin, true)
+}
+
+// contains check if the list has s, ignoring case with fold
+func contains(list []string, s string, fold bool) bool {
+	for _, v := range list {
+		if v == s || (fold && strings.EqualFold(v, s)) {
+			return true
+		}
+	}
+	return false
+}
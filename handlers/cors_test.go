@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS_Preflight(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+	config := DefaultCORSConfig
+	config.AllowedOrigins = []string{"https://app.example.com"}
+	config.AllowCredentials = true
+	handler := CORS(config, http.HandlerFunc(h.ArticlesHandler))
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("OPTIONS", "/api/articles/title-1", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := preflight("https://app.example.com", "PUT", "authorization, content-type")
+	if Code := recorder.Code; Code != http.StatusNoContent {
+		t.Fatalf("should return a 204 status code: got %v wamt %v", Code, http.StatusNoContent)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+		"Access-Control-Allow-Headers":     "authorization, content-type",
+		"Access-Control-Max-Age":           "600",
+	}
+	for name, value := range want {
+		if got := recorder.Header().Get(name); got != value {
+			t.Errorf("should set %v: got %q wamt %q", name, got, value)
+		}
+	}
+
+	tests := []struct {
+		origin, method, headers string
+	}{
+		{"https://evil.example.com", "PUT", "authorization"},
+		{"https://app.example.com", "PATCH", ""},
+		{"https://app.example.com", "PUT", "x-unknown"},
+	}
+	for _, tt := range tests {
+		recorder := preflight(tt.origin, tt.method, tt.headers)
+		if Code := recorder.Code; Code != http.StatusForbidden {
+			t.Errorf("%v should return a 403 status code: got %v wamt %v", tt, Code, http.StatusForbidden)
+		}
+		if got := recorder.Header().Get("Access-Control-Allow-Methods"); got != "" {
+			t.Errorf("%v should not allow the request: got %q", tt, got)
+		}
+	}
+}
+
+func TestCORS_Request(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+	handler := CORS(DefaultCORSConfig, http.HandlerFunc(h.ArticlesHandler))
+
+	req, _ := http.NewRequest("GET", "/api/articles/title-1", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusOK {
+		t.Errorf("should pass the request to the router: got %v wamt %v", Code, http.StatusOK)
+	}
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("should allow any origin: got %q wamt %q", got, "*")
+	}
+	if got := recorder.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "ETag") ||
+		!strings.Contains(got, "X-RateLimit-Remaining") || !strings.Contains(got, "X-Request-ID") {
+		t.Errorf("should expose the ETag, rate limit and request id headers: got %q", got)
+	}
+
+	config := DefaultCORSConfig
+	config.AllowedOrigins = []string{"https://app.example.com"}
+	handler = CORS(config, http.HandlerFunc(h.ArticlesHandler))
+
+	req.Header.Set("Origin", "https://other.example.com")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("should not allow another origin: got %q", got)
+	}
+	if got := recorder.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("should vary on Origin: got %q wamt %q", got, "Origin")
+	}
+}
@@ -1,30 +1,109 @@
 package handlers
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/markdown"
 	"github.com/JackyChiu/realworld-starter-kit/models"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
+// DefaultRestoreWindow is how long after deleting an article
+// its author can restore it
+const DefaultRestoreWindow = 7 * 24 * time.Hour
+
 type Handler struct {
-	DB     models.Datastorer
-	JWT    auth.Tokener
-	Logger *log.Logger
+	DB             models.Datastorer
+	JWT            auth.Tokener
+	Logger         *slog.Logger
+	RestoreWindow  time.Duration
+	TrendingWindow time.Duration
+	Markdown       *markdown.Renderer
+	// RateLimits maps route groups to their limit, groups without limit
+	// are not limited
+	RateLimits  map[string]RateLimit
+	RateLimiter RateLimitStore
+	// TrustProxy takes the client IP from X-Forwarded-For
+	TrustProxy bool
+	Metrics    *Metrics
+
+	related *relatedCache
 }
 
-func New(db *models.DB, jwt *auth.JWT, logger *log.Logger) *Handler {
-	return &Handler{db, jwt, logger}
+func New(db models.Datastorer, jwt auth.Tokener, logger *slog.Logger) *Handler {
+	rateLimits := make(map[string]RateLimit)
+	for group, limit := range DefaultRateLimits {
+		rateLimits[group] = limit
+	}
+
+	return &Handler{
+		DB:             db,
+		JWT:            jwt,
+		Logger:         logger,
+		RestoreWindow:  DefaultRestoreWindow,
+		TrendingWindow: models.DefaultTrendingWindow,
+		Markdown:       markdown.NewRenderer(markdown.DefaultCacheSize),
+		RateLimits:     rateLimits,
+		RateLimiter:    NewMemoryRateLimitStore(),
+		Metrics:        NewMetrics(),
+		related:        newRelatedCache(),
+	}
 }
 
-func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
-	h.Logger.Println(r.Method, r.URL.Path)
+// renderMarkdown returns the sanitized HTML of a Markdown body cached under
+// key, which must change with the body. Article bodies are keyed by their
+// revision and comment bodies should be keyed the same way by their id and
+// update time.
+func (h *Handler) renderMarkdown(key, body string) string {
+	if body == "" {
+		return ""
+	}
+
+	html, err := h.Markdown.Render(key, body)
+	if err != nil {
+		h.Logger.Error("rendering markdown", "key", key, "error", err)
+		return ""
+	}
+	return html
+}
+
+// revisionKey is the markdown cache key of an article body at a revision
+func revisionKey(articleID, number int) string {
+	return fmt.Sprintf("article/%d@%d", articleID, number)
+}
 
+// checkRequest authenticates the request either with a JWT or with a
+// personal access token and returns the matching claims
+func (h *Handler) checkRequest(r *http.Request) (*auth.Claims, error) {
+	token, err := auth.ExtractToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !auth.IsPersonalToken(token) {
+		return h.JWT.CheckRequest(r)
+	}
+
+	t, err := h.store(r).FindAPITokenByHash(models.HashAPIToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("Token not valid")
+	}
+
+	if err := h.store(r).TouchAPIToken(t); err != nil {
+		h.log(r).Error("touching API token", "token", t.ID, "error", err)
+	}
+
+	return auth.NewPersonalClaims(t.User.Username, t.ScopeList()), nil
+}
+
+func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		h.RegisterUser(w, r)
+		setRoute(r.Context(), "/api/users")
+		h.rateLimit(RateLimitAuth, h.RegisterUser)(w, r)
 	case "GET":
 		// TODO:
 		// Check auth
@@ -39,11 +118,10 @@ func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	h.Logger.Println(r.Method, r.URL.Path)
-
 	switch r.Method {
 	case "POST":
-		h.LoginUser(w, r)
+		setRoute(r.Context(), "/api/users/login")
+		h.rateLimit(RateLimitAuth, h.LoginUser)(w, r)
 	default:
 		http.NotFound(w, r)
 	}
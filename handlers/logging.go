@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the id of a request, it is honoured when sent by
+// the client or a proxy and returned with every response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of the request ids taken from clients
+const maxRequestIDLength = 128
+
+const requestInfoKey = contextKey("request_info")
+
+// requestInfo follows a request for its logs and metrics. The user and
+// the route are filled deep in the routers, by getCurrentUser and
+// Router.ServeHTTP.
+type requestInfo struct {
+	id    string
+	user  string
+	route string
+}
+
+// RequestID gives every request an id, taken from X-Request-ID when valid
+// or generated, and returns it in the X-Request-ID header of the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestInfoKey, &requestInfo{id: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the id given to the request by RequestID
+func RequestIDFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// isValidRequestID check if id is short and only made of printable ASCII,
+// so it can't forge log lines
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusWriter records the status and the size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// statusCode returns the status of the response, 200 when the handler
+// wrote nothing
+func (w *statusWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog logs every request once answered with its status, the bytes
+// written, its duration and the authenticated user. Server errors are
+// logged at the error level.
+func (h *Handler) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		info, r := withRequestInfo(r)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.statusCode()
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		h.log(r).LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", info.route),
+			slog.Int("status", status),
+			slog.Int("bytes", sw.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("user", info.user),
+			slog.String("remote", h.clientIP(r)),
+		)
+	})
+}
+
+// log returns the logger of the request, its lines carry the request id
+// and, when traced, the trace id
+func (h *Handler) log(r *http.Request) *slog.Logger {
+	logger := h.Logger
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		logger = logger.With(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		logger = logger.With(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return logger
+}
+
+// withRequestInfo returns the requestInfo of r, adding one to its context
+// when the request went through no other middleware
+func withRequestInfo(r *http.Request) (*requestInfo, *http.Request) {
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+		return info, r
+	}
+	info := &requestInfo{}
+	return info, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+}
+
+// setLogUser records the authenticated user of the request for the
+// access log
+func setLogUser(ctx context.Context, username string) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.user = username
+	}
+}
+
+// setRoute records the route matched by the request, it labels its logs
+// and metrics instead of the raw path
+func setRoute(ctx context.Context, route string) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.route = route
+	}
+}
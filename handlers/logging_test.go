@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+)
+
+func TestRequestID(t *testing.T) {
+	var got string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{"forged\nline", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/api/articles", nil)
+		req.Header.Set(RequestIDHeader, tt.header)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		id := recorder.Header().Get(RequestIDHeader)
+		if id != got {
+			t.Errorf("%q should return the id of the request: got %q want %q", tt.header, id, got)
+		}
+		if keep := id == tt.header; keep != tt.keep {
+			t.Errorf("%q should be kept %v: got %q", tt.header, tt.keep, id)
+		}
+		if !tt.keep && len(id) != 32 {
+			t.Errorf("%q should be replaced by a random id: got %q", tt.header, id)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	var buf bytes.Buffer
+	h.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := RequestID(h.AccessLog(http.HandlerFunc(h.ArticlesHandler)))
+
+	jwt := auth.NewJWT().NewToken("user1")
+	for _, url := range []string{"/api/articles/title-1", "/api/articles/unknown"} {
+		buf.Reset()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+		req.Header.Set(RequestIDHeader, "request-1")
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if id := recorder.Header().Get(RequestIDHeader); id != "request-1" {
+			t.Errorf("%s should return the request id: got %q wamt %q", url, id, "request-1")
+		}
+
+		var line struct {
+			Level     string
+			Msg       string
+			RequestID string `json:"request_id"`
+			Method    string
+			Path      string
+			Status    int
+			Bytes     int
+			User      string
+		}
+		if err := json.NewDecoder(&buf).Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+
+		if line.Msg != "request" || line.Method != "GET" || line.Path != url {
+			t.Errorf("%s should log the request: got %+v", url, line)
+		}
+		if line.Status != recorder.Code || line.Bytes != recorder.Body.Len() {
+			t.Errorf("%s should log the response: got %v %v wamt %v %v", url, line.Status, line.Bytes, recorder.Code, recorder.Body.Len())
+		}
+		if line.RequestID != "request-1" || line.User != "user1" {
+			t.Errorf("%s should log the request id and user: got %q %q", url, line.RequestID, line.User)
+		}
+	}
+}
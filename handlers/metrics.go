@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/metrics"
+)
+
+// unmatchedRoute labels the requests matching no route, so unknown paths
+// can't grow the number of series
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels the requests with a non standard method, clients can
+// send any method
+const otherMethod = "OTHER"
+
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Metrics are the metrics of the server, exposed at /metrics
+type Metrics struct {
+	*metrics.Registry
+
+	Requests         *metrics.Counter
+	RequestDuration  *metrics.Histogram
+	RequestsInFlight *metrics.Gauge
+	QueryDuration    *metrics.Histogram
+
+	Registrations   *metrics.Counter
+	Logins          *metrics.Counter
+	ArticlesCreated *metrics.Counter
+	Favorites       *metrics.Counter
+}
+
+func NewMetrics() *Metrics {
+	r := metrics.NewRegistry()
+	return &Metrics{
+		Registry: r,
+
+		Requests: r.NewCounter("http_requests_total",
+			"Requests answered, by method, route and status.", "method", "route", "status"),
+		RequestDuration: r.NewHistogram("http_request_duration_seconds",
+			"Time to answer requests, by method and route.", metrics.DefaultBuckets, "method", "route"),
+		RequestsInFlight: r.NewGauge("http_requests_in_flight",
+			"Requests being answered."),
+		QueryDuration: r.NewHistogram("db_query_duration_seconds",
+			"Time to run datastore queries, by operation and table.", metrics.DefaultBuckets, "operation", "table"),
+
+		Registrations: r.NewCounter("conduit_registrations_total",
+			"Users registered."),
+		Logins: r.NewCounter("conduit_logins_total",
+			"Successful logins."),
+		ArticlesCreated: r.NewCounter("conduit_articles_created_total",
+			"Articles created."),
+		Favorites: r.NewCounter("conduit_favorites_total",
+			"Articles favorited."),
+	}
+}
+
+// ObserveQuery records the duration of a datastore query, it is given to
+// models.DB.InstrumentQueries
+func (m *Metrics) ObserveQuery(operation, table string, d time.Duration) {
+	m.QueryDuration.Observe(d.Seconds(), operation, table)
+}
+
+// Instrument counts the requests and measures their duration by route, the
+// pattern matched by the routers rather than the raw path
+func (h *Handler) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := h.Metrics
+		start := time.Now()
+		m.RequestsInFlight.Inc()
+		defer m.RequestsInFlight.Dec()
+
+		info, r := withRequestInfo(r)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		route := info.route
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := r.Method
+		if !standardMethods[method] {
+			method = otherMethod
+		}
+		m.Requests.Inc(method, route, strconv.Itoa(sw.statusCode()))
+		m.RequestDuration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
+
+// MetricsHandler handle GET /metrics
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.NotFound(w, r)
+		return
+	}
+	setRoute(r.Context(), "/metrics")
+	h.Metrics.ServeHTTP(w, r)
+}
+
+var (
+	routeTemplates sync.Map
+
+	namedGroup = regexp.MustCompile(`\(\?P<(\w+)>[^)]*\)`)
+)
+
+// routeTemplate turns a router pattern into the route it handles, like
+// /api/articles/:slug for `articles\/(?P<slug>[0-9a-zA-Z\-]+)$`
+func routeTemplate(pattern string) string {
+	if route, ok := routeTemplates.Load(pattern); ok {
+		return route.(string)
+	}
+
+	route := namedGroup.ReplaceAllString(pattern, ":$1")
+	route = strings.TrimSuffix(route, "$")
+	route = strings.TrimSuffix(route, `\/?`)
+	route = "/api/" + strings.ReplaceAll(route, `\/`, "/")
+
+	routeTemplates.Store(pattern, route)
+	return route
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/metrics"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		route   string
+	}{
+		{`articles\/?$`, "/api/articles"},
+		{`articles\/(?P<slug>[0-9a-zA-Z\-]+)$`, "/api/articles/:slug"},
+		{`articles\/(?P<slug>[0-9a-zA-Z\-]+)\/revisions\/(?P<number>[0-9]+)\/diff$`, "/api/articles/:slug/revisions/:number/diff"},
+		{`user\/tokens\/?$`, "/api/user/tokens"},
+	}
+
+	for _, tt := range tests {
+		if route := routeTemplate(tt.pattern); route != tt.route {
+			t.Errorf("%s should be the route: got %v wamt %v", tt.pattern, route, tt.route)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+	handler := h.Instrument(http.HandlerFunc(h.ArticlesHandler))
+
+	jwt := auth.NewJWT().NewToken("user1")
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{"GET", "/api/articles/title-1"},
+		{"GET", "/api/articles/title-3"},
+		{"POST", "/api/articles/title-2/favorite"},
+		{"GET", "/api/articles/title-1/unknown"},
+		{"BREW", "/api/articles/title-1"},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, r.url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	recorder := httptest.NewRecorder()
+	h.MetricsHandler(recorder, req)
+
+	if ct := recorder.Header().Get("Content-Type"); ct != metrics.ContentType {
+		t.Errorf("should serve the text format: got %v wamt %v", ct, metrics.ContentType)
+	}
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/api/articles/:slug",status="200"} 2`,
+		`http_requests_total{method="POST",route="/api/articles/:slug/favorite",status="200"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="200"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/api/articles/:slug"} 2`,
+		`http_requests_in_flight 0`,
+		`conduit_favorites_total 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("should expose %s: got\n%s", line, body)
+		}
+	}
+	if !strings.Contains(body, `method="OTHER"`) || strings.Contains(body, `method="BREW"`) {
+		t.Errorf("should label non standard methods as OTHER: got\n%s", body)
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+)
+
+// Route groups sharing a rate limit
+const (
+	RateLimitArticles  = "articles"
+	RateLimitFavorites = "favorites"
+	RateLimitAuth      = "auth"
+)
+
+// RateLimit allows bursts of Requests requests, then one request every
+// Per / Requests
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// DefaultRateLimits are the limits of every route group: article writes,
+// favorites, and login and registration
+var DefaultRateLimits = map[string]RateLimit{
+	RateLimitArticles:  {Requests: 10, Per: time.Minute},
+	RateLimitFavorites: {Requests: 60, Per: time.Minute},
+	RateLimitAuth:      {Requests: 10, Per: time.Minute},
+}
+
+// ParseRateLimit parses a limit written requests/duration, like 10/1m
+func ParseRateLimit(s string) (RateLimit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("Invalid rate limit: %s", s)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 1 {
+		return RateLimit{}, fmt.Errorf("Invalid rate limit requests: %s", parts[0])
+	}
+
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("Invalid rate limit duration: %s", parts[1])
+	}
+
+	return RateLimit{Requests: requests, Per: per}, nil
+}
+
+// rate returns the tokens refilled per second
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// RateLimitResult is the state of a token bucket after taking a token
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until a token is available, when not allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// RateLimitStore keeps the token buckets. The memory store limits each
+// server on its own, a store shared by every server, like Redis, must take
+// tokens atomically.
+type RateLimitStore interface {
+	Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore keeps the token buckets in process
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	limit   RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimitSweepInterval is how often full buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// Take takes a token from the bucket of key, buckets start full
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > rateLimitSweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	return b.take(now), nil
+}
+
+// sweep drops the buckets full again, they are the same as new ones
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.refill(now) >= float64(b.limit.Requests) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// refill returns the tokens of the bucket at now
+func (b *tokenBucket) refill(now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(b.limit.Requests), b.tokens+elapsed*b.limit.rate())
+}
+
+func (b *tokenBucket) take(now time.Time) RateLimitResult {
+	b.tokens = b.refill(now)
+	b.updated = now
+
+	var result RateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / b.limit.rate())
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((float64(b.limit.Requests) - b.tokens) / b.limit.rate())
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// rateLimit limits the requests of a route group. Authenticated requests
+// are counted by user, other ones by client IP, so it must run after
+// getCurrentUser. Store errors let the request through.
+func (h *Handler) rateLimit(group string, next http.HandlerFunc) http.HandlerFunc {
+	return traceStep("rateLimit", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		limit, ok := h.RateLimits[group]
+		if !ok || h.RateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := group + "/ip:" + h.clientIP(r)
+		if claim, ok := r.Context().Value(Claim).(*auth.Claims); ok {
+			key = group + "/user:" + claim.Username
+		}
+
+		result, err := h.RateLimiter.Take(key, limit, time.Now())
+		if err != nil {
+			h.log(r).Error("taking a rate limit token", "key", key, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("X-RateLimit-Reset", ceilSeconds(result.Reset))
+
+		if !result.Allowed {
+			header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+			http.Error(w, "Too many requests, retry later", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds formats d in whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// clientIP returns the IP of the client. Behind a proxy, enabled with
+// TrustProxy, it is the last address of X-Forwarded-For, the one added by
+// the proxy, earlier ones can be forged by the client.
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
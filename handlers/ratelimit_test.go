@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RateLimit
+		ok   bool
+	}{
+		{"10/1m", RateLimit{10, time.Minute}, true},
+		{"1/500ms", RateLimit{1, 500 * time.Millisecond}, true},
+		{"10", RateLimit{}, false},
+		{"0/1m", RateLimit{}, false},
+		{"10/0s", RateLimit{}, false},
+		{"ten/1m", RateLimit{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRateLimit(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q should parse to %v: got %v, %v", tt.in, tt.want, got, err)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 2, Per: time.Second}
+	now := time.Now()
+
+	for i, want := range []int{1, 0} {
+		result, _ := s.Take("key", limit, now)
+		if !result.Allowed || result.Remaining != want {
+			t.Errorf("should allow a burst of %v: got %+v at %v", limit.Requests, result, i)
+		}
+	}
+
+	result, _ := s.Take("key", limit, now)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond || result.Reset != time.Second {
+		t.Errorf("should deny an empty bucket: got %+v", result)
+	}
+
+	if result, _ := s.Take("other", limit, now); !result.Allowed {
+		t.Errorf("should keep a bucket per key")
+	}
+
+	if result, _ := s.Take("key", limit, now.Add(500*time.Millisecond)); !result.Allowed {
+		t.Errorf("should refill the bucket over time")
+	}
+
+	s.Take("key", limit, now.Add(time.Hour))
+	if len(s.buckets) != 1 {
+		t.Errorf("should drop the full buckets: got %v want %v", len(s.buckets), 1)
+	}
+}
+
+func TestArticlesHandler_RateLimit(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+	h.RateLimits[RateLimitFavorites] = RateLimit{Requests: 2, Per: time.Minute}
+
+	favorite := func(username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/articles/title-2/favorite", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if username != "" {
+			jwt := auth.NewJWT().NewToken(username)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+		}
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for _, want := range []string{"1", "0"} {
+		recorder := favorite("user1")
+		if Code := recorder.Code; Code == http.StatusTooManyRequests {
+			t.Fatalf("should allow the first requests: got %v", Code)
+		}
+		if got := recorder.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Errorf("should return the remaining requests: got %v wamt %v", got, want)
+		}
+		if got := recorder.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("should return the limit: got %v wamt %v", got, "2")
+		}
+	}
+
+	recorder := favorite("user1")
+	if Code := recorder.Code; Code != http.StatusTooManyRequests {
+		t.Errorf("should return a 429 status code: got %v wamt %v", Code, http.StatusTooManyRequests)
+	}
+	if got := recorder.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("should return when to retry: got %v wamt %v", got, "30")
+	}
+	if got := recorder.Header().Get("X-RateLimit-Reset"); got != "60" {
+		t.Errorf("should return when the limit resets: got %v wamt %v", got, "60")
+	}
+
+	if Code := favorite("user2").Code; Code == http.StatusTooManyRequests {
+		t.Errorf("should limit users separately: got %v", Code)
+	}
+
+	// Anonymous requests are limited by IP
+	favorite("")
+	favorite("")
+	if Code := favorite("").Code; Code != http.StatusTooManyRequests {
+		t.Errorf("should limit anonymous requests: got %v wamt %v", Code, http.StatusTooManyRequests)
+	}
+}
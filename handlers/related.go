@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/models"
+)
+
+// RelatedCacheTTL is how long related articles are cached
+const RelatedCacheTTL = 5 * time.Minute
+
+// relatedCacheSize bounds the number of cached related article lists
+const relatedCacheSize = 1000
+
+// maxRelatedLimit bounds the limit parameter of the related articles
+const maxRelatedLimit = 50
+
+// relatedCache keeps related article lists for RelatedCacheTTL. Entries
+// are keyed by the article revision so editing an article refreshes them.
+type relatedCache struct {
+	mu      sync.Mutex
+	entries map[string]relatedEntry
+}
+
+type relatedEntry struct {
+	articles []models.Article
+	expires  time.Time
+}
+
+func newRelatedCache() *relatedCache {
+	return &relatedCache{entries: make(map[string]relatedEntry)}
+}
+
+func (c *relatedCache) get(key string) ([]models.Article, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.articles, true
+}
+
+func (c *relatedCache) set(key string, articles []models.Article) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= relatedCacheSize {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// Still full of live entries, start over rather than tracking usage
+	if len(c.entries) >= relatedCacheSize {
+		c.entries = make(map[string]relatedEntry)
+	}
+
+	c.entries[key] = relatedEntry{articles: articles, expires: now.Add(RelatedCacheTTL)}
+}
+
+// getRelatedArticles handle GET /api/articles/:slug/related
+func (h *Handler) getRelatedArticles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	a := ctx.Value(FetchedArticle).(*models.Article)
+	u := ctx.Value(CurrentUser).(*models.User)
+
+	query := models.ArticleQuery{
+		ViewerID: u.ID,
+		Limit:    5,
+	}
+
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 {
+		query.Limit = limit
+	}
+	if query.Limit > maxRelatedLimit {
+		query.Limit = maxRelatedLimit
+	}
+
+	key := fmt.Sprintf("%d@%d/%d/%d", a.ID, a.Revision, u.ID, query.Limit)
+	articles, ok := h.related.get(key)
+
+	var err error
+	if !ok {
+		if articles, err = h.store(r).GetRelatedArticles(a, query); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.related.set(key, articles)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(articles) == 0 {
+		json.NewEncoder(w).Encode(ArticlesJSON{})
+		return
+	}
+
+	var articlesJSON ArticlesJSON
+	articlesJSON.Articles, err = h.buildArticlesJSON(r, articles, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	articlesJSON.ArticlesCount = len(articles)
+
+	json.NewEncoder(w).Encode(articlesJSON)
+}
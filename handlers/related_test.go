@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/models"
+)
+
+func TestArticlesHandler_Related(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	tests := []struct {
+		url      string
+		username string
+		code     int
+		slugs    []string
+	}{
+		{"/api/articles/title-1/related", "", http.StatusOK, []string{"title-5", "title-3"}},
+		{"/api/articles/title-1/related?limit=1", "", http.StatusOK, []string{"title-5"}},
+		{"/api/articles/title-1/related", "user1", http.StatusOK, nil},
+		{"/api/articles/unknown/related", "", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		if tt.username != "" {
+			jwt := auth.NewJWT().NewToken(tt.username)
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+		}
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		if Code := recorder.Code; Code != tt.code {
+			t.Errorf("%s should return a %v status code: got %v", tt.url, tt.code, Code)
+			continue
+		}
+
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		var articles ArticlesJSON
+		json.NewDecoder(recorder.Body).Decode(&articles)
+
+		var slugs []string
+		for _, a := range articles.Articles {
+			slugs = append(slugs, a.Slug)
+		}
+
+		if fmt.Sprint(slugs) != fmt.Sprint(tt.slugs) {
+			t.Errorf("%s as %q should return %v: got %v", tt.url, tt.username, tt.slugs, slugs)
+		}
+	}
+}
+
+func TestArticlesHandler_RelatedIsCached(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	get := func() int {
+		req, _ := http.NewRequest("GET", "/api/articles/title-1/related", nil)
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.ArticlesHandler).ServeHTTP(recorder, req)
+
+		var articles ArticlesJSON
+		json.NewDecoder(recorder.Body).Decode(&articles)
+		return articles.ArticlesCount
+	}
+
+	if n := get(); n != 2 {
+		t.Fatalf("should return the related articles: got %v wamt %v", n, 2)
+	}
+
+	u, _ := h.DB.FindUserByUsername("user1")
+	if err := h.DB.CreateArticle(models.NewArticle("Another", "Description", "Body", u)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := get(); n != 2 {
+		t.Errorf("should serve the related articles from the cache: got %v wamt %v", n, 2)
+	}
+}
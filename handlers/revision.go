@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/diff"
+	"github.com/JackyChiu/realworld-starter-kit/models"
+)
+
+type Revision struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Body        string    `json:"body"`
+	BodyHTML    string    `json:"bodyHtml,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Author      Author    `json:"author"`
+}
+
+type RevisionJSON struct {
+	Revision Revision `json:"revision"`
+}
+
+type RevisionsJSON struct {
+	Revisions      []Revision `json:"revisions"`
+	RevisionsCount int        `json:"revisionsCount"`
+}
+
+const FetchedRevision = contextKey("revision")
+
+// extractRevision loads the revision numbered in the URL of the
+// article fetched by extractArticle
+func (h *Handler) extractRevision(next http.HandlerFunc) http.HandlerFunc {
+	return traceStep("extractRevision", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		ctx := r.Context()
+		a := ctx.Value(FetchedArticle).(*models.Article)
+
+		number, err := strconv.Atoi(ctx.Value("number").(string))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		revision, err := h.store(r).GetRevision(a.ID, number)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, FetchedRevision, revision)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getRevisions handle GET /api/articles/:slug/revisions
+func (h *Handler) getRevisions(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(FetchedArticle).(*models.Article)
+
+	revisions, err := h.store(r).GetRevisions(a.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revisionsJSON := RevisionsJSON{Revisions: []Revision{}}
+	for i := range revisions {
+		revisionsJSON.Revisions = append(revisionsJSON.Revisions, h.buildRevisionJSON(&revisions[i]))
+	}
+	revisionsJSON.RevisionsCount = len(revisions)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisionsJSON)
+}
+
+// getRevision handle GET /api/articles/:slug/revisions/:number
+func (h *Handler) getRevision(w http.ResponseWriter, r *http.Request) {
+	revision := r.Context().Value(FetchedRevision).(*models.ArticleRevision)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevisionJSON{Revision: h.buildRevisionJSON(revision)})
+}
+
+// diffRevision handle GET /api/articles/:slug/revisions/:number/diff
+// It returns the unified diff from the previous revision, or from the
+// revision given by the `from` query parameter.
+func (h *Handler) diffRevision(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(FetchedArticle).(*models.Article)
+	to := r.Context().Value(FetchedRevision).(*models.ArticleRevision)
+
+	fromNumber := to.Number - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		fromNumber = n
+	}
+
+	from := &models.ArticleRevision{}
+	if fromNumber > 0 {
+		var err error
+		if from, err = h.store(r).GetRevision(a.ID, fromNumber); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	var fields = []struct {
+		name     string
+		from, to string
+	}{
+		{"title", from.Title, to.Title},
+		{"description", from.Description, to.Description},
+		{"body", from.Body, to.Body},
+	}
+
+	var sb strings.Builder
+	for _, f := range fields {
+		d, err := diff.Unified(
+			fmt.Sprintf("a/%s@%d", f.name, fromNumber),
+			fmt.Sprintf("b/%s@%d", f.name, to.Number),
+			f.from, f.to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		sb.WriteString(d)
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	fmt.Fprint(w, sb.String())
+}
+
+// revertArticle handle POST /api/articles/:slug/revisions/:number/revert
+// The article gets the content of the revision, recorded as a new revision.
+func (h *Handler) revertArticle(w http.ResponseWriter, r *http.Request) {
+	a := r.Context().Value(FetchedArticle).(*models.Article)
+	u := r.Context().Value(CurrentUser).(*models.User)
+	revision := r.Context().Value(FetchedRevision).(*models.ArticleRevision)
+
+	if !a.IsOwnedBy(u.Username) {
+		err := fmt.Errorf("You don't have the permission to revert this article")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	a.Title = revision.Title
+	a.Description = revision.Description
+	a.Body = revision.Body
+
+	if err := h.store(r).SaveArticle(a); err == models.ErrVersionConflict {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	articleJSON := ArticleJSON{
+		Article: h.buildArticleJSON(r, a, u),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(articleJSON)
+}
+
+func (h *Handler) buildRevisionJSON(revision *models.ArticleRevision) Revision {
+	return Revision{
+		Number:      revision.Number,
+		Title:       revision.Title,
+		Description: revision.Description,
+		Body:        revision.Body,
+		BodyHTML:    h.renderMarkdown(revisionKey(revision.ArticleID, revision.Number), revision.Body),
+		CreatedAt:   revision.CreatedAt,
+		Author: Author{
+			Username: revision.User.Username,
+			Bio:      revision.User.Bio,
+			Image:    revision.User.Image,
+		},
+	}
+}
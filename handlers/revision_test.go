@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/diff"
+)
+
+// newRevisedHandler returns a test handler where title-1 has a second
+// revision with an updated body
+func newRevisedHandler(t *testing.T) *Handler {
+	h := newTestHandler(t)
+
+	a, _ := h.DB.GetArticle("title-1")
+	a.Body = "Body 1\nwith a second line"
+	if err := h.DB.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestRevisions_Index(t *testing.T) {
+	t.Parallel()
+	h := newRevisedHandler(t)
+
+	req, err := http.NewRequest("GET", "/api/articles/title-1/revisions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	var revisions RevisionsJSON
+	json.NewDecoder(recorder.Body).Decode(&revisions)
+
+	if revisions.RevisionsCount != 2 {
+		t.Fatalf("should return every revision: got %v want %v", revisions.RevisionsCount, 2)
+	}
+
+	if r := revisions.Revisions[0]; r.Number != 1 || r.Body != "Body 1" {
+		t.Errorf("should return the first revision first: got %+v", r)
+	}
+}
+
+func TestRevisions_Read(t *testing.T) {
+	t.Parallel()
+	h := newRevisedHandler(t)
+
+	req, err := http.NewRequest("GET", "/api/articles/title-1/revisions/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	var revision RevisionJSON
+	json.NewDecoder(recorder.Body).Decode(&revision)
+
+	if revision.Revision.Body != "Body 1\nwith a second line" {
+		t.Errorf("should return the revision body: got %v", revision.Revision.Body)
+	}
+
+	if revision.Revision.Author.Username != "user1" {
+		t.Errorf("should return the revision author: got %v want %v", revision.Revision.Author.Username, "user1")
+	}
+}
+
+func TestRevisions_Diff(t *testing.T) {
+	t.Parallel()
+	h := newRevisedHandler(t)
+
+	req, err := http.NewRequest("GET", "/api/articles/title-1/revisions/2/diff", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	want := "--- a/body@1\n+++ b/body@2\n@@ -1 +1,2 @@\n Body 1\n+with a second line\n"
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("should return the unified diff of the body: got\n%v\nwant\n%v", got, want)
+	}
+
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/x-diff") {
+		t.Errorf("should return a diff content type: got %v", ct)
+	}
+}
+
+func TestRevisions_DiffTooLarge(t *testing.T) {
+	t.Parallel()
+	h := newRevisedHandler(t)
+
+	a, _ := h.DB.GetArticle("title-1")
+	a.Body = strings.Repeat("line\n", diff.MaxChangedLines+1)
+	if err := h.DB.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "/api/articles/title-1/revisions/3/diff", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusUnprocessableEntity {
+		t.Errorf("should refuse to diff too many changed lines: got %v wamt %v", Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestRevisions_Revert(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		code     int
+		body     string
+	}{
+		{"Ok", "user1", http.StatusOK, "Body 1"},
+		{"WrongOwner", "user2", http.StatusForbidden, "Body 1\nwith a second line"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := newRevisedHandler(t)
+
+			req, err := http.NewRequest("POST", "/api/articles/title-1/revisions/1/revert", bytes.NewBuffer(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jwt := auth.NewJWT().NewToken(tt.username)
+			req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+			recorder := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.ArticlesHandler)
+
+			handler.ServeHTTP(recorder, req)
+
+			if Code := recorder.Code; Code != tt.code {
+				t.Errorf("should get a %v status code: got %v wamt %v", tt.code, Code, tt.code)
+			}
+
+			a, _ := h.DB.GetArticle("title-1")
+			if a.Body != tt.body {
+				t.Errorf("should have the expected body: got %q want %q", a.Body, tt.body)
+			}
+
+			revisions, _ := h.DB.GetRevisions(a.ID)
+			if tt.code == http.StatusOK && len(revisions) != 3 {
+				t.Errorf("should record the revert as a new revision: got %v want %v", len(revisions), 3)
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 )
@@ -15,7 +15,7 @@ type Route struct {
 type Router struct {
 	http.Handler
 	routes []Route
-	logger *log.Logger
+	logger *slog.Logger
 	debug  bool
 }
 
@@ -25,7 +25,7 @@ func (c contextKey) String() string {
 	return string(c)
 }
 
-func NewRouter(logger *log.Logger) *Router {
+func NewRouter(logger *slog.Logger) *Router {
 	return &Router{
 		routes: make([]Route, 0),
 		logger: logger,
@@ -73,8 +73,9 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if matched, _ := regexp.MatchString(route.Pattern, r.URL.Path); matched {
 			if h, registered := route.ActionHandlers[r.Method]; registered {
 				if router.debug {
-					router.logger.Println(r.Method, r.URL.Path)
+					router.logger.Debug("route", "method", r.Method, "path", r.URL.Path, "pattern", route.Pattern)
 				}
+				setRoute(r.Context(), routeTemplate(route.Pattern))
 				r = r.WithContext(buildContext(route.Pattern, r))
 				h.ServeHTTP(w, r)
 			} else {
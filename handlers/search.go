@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/models"
+)
+
+// SearchArticle is an article search result, its snippet is HTML with the
+// matches wrapped in <mark>
+type SearchArticle struct {
+	Article
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchJSON struct {
+	Articles      []SearchArticle `json:"articles"`
+	ArticlesCount int             `json:"articlesCount"`
+}
+
+// SearchHandler handle /api/search
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	router := NewRouter(h.Logger)
+	router.AddRoute(
+		`search\/?$`,
+		"GET", h.getCurrentUser(h.requireScope(auth.ScopeReadArticles, h.searchArticles)))
+
+	router.ServeHTTP(w, r)
+}
+
+// searchArticles handle GET /api/search?q=
+// articlesCount is the total number of matches, not the size of the page.
+func (h *Handler) searchArticles(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	u := r.Context().Value(CurrentUser).(*models.User)
+
+	query := models.SearchQuery{
+		Query:    strings.TrimSpace(queryParams.Get("q")),
+		ViewerID: u.ID,
+		Limit:    20,
+	}
+
+	if query.Query == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		errs := models.ValidationMessages{"q": []string{"q parameter can't be blank"}}
+		json.NewEncoder(w).Encode(errorResponse{Errors: errs})
+		return
+	}
+
+	if limit, err := strconv.Atoi(queryParams.Get("limit")); err == nil && limit > 0 {
+		query.Limit = limit
+	}
+
+	if offset, err := strconv.Atoi(queryParams.Get("offset")); err == nil && offset > 0 {
+		query.Offset = offset
+	}
+
+	results, total, err := h.store(r).SearchArticles(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	articles := make([]models.Article, len(results))
+	for i := range results {
+		articles[i] = results[i].Article
+	}
+
+	articlesJSON, err := h.buildArticlesJSON(r, articles, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	searchJSON := SearchJSON{
+		Articles:      []SearchArticle{},
+		ArticlesCount: total,
+	}
+	for i := range articlesJSON {
+		searchJSON.Articles = append(searchJSON.Articles, SearchArticle{
+			Article: articlesJSON[i],
+			Rank:    results[i].Rank,
+			Snippet: results[i].Snippet,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(searchJSON)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchHandler(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	tests := []struct {
+		url   string
+		code  int
+		count int
+		slugs []string
+	}{
+		{"/api/search?q=title+3", http.StatusOK, 1, []string{"title-3"}},
+		{"/api/search?q=tag4", http.StatusOK, 1, []string{"title-2"}},
+		{"/api/search?q=title&limit=2", http.StatusOK, 5, []string{"title-5", "title-4"}},
+		{"/api/search?q=title&limit=2&offset=4", http.StatusOK, 5, []string{"title-1"}},
+		{"/api/search?q=nothing", http.StatusOK, 0, nil},
+		{"/api/search?q=", http.StatusUnprocessableEntity, 0, nil},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(h.SearchHandler).ServeHTTP(recorder, req)
+
+		if Code := recorder.Code; Code != tt.code {
+			t.Errorf("%s should return a %v status code: got %v", tt.url, tt.code, Code)
+			continue
+		}
+
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		var searchResponse SearchJSON
+		json.NewDecoder(recorder.Body).Decode(&searchResponse)
+
+		if searchResponse.ArticlesCount != tt.count {
+			t.Errorf("%s should count %v matches: got %v", tt.url, tt.count, searchResponse.ArticlesCount)
+		}
+
+		var slugs []string
+		for _, a := range searchResponse.Articles {
+			slugs = append(slugs, a.Slug)
+			if a.Snippet == "" || a.Rank <= 0 {
+				t.Errorf("%s should return a snippet and a rank: got %q %v", tt.url, a.Snippet, a.Rank)
+			}
+		}
+
+		if len(slugs) != len(tt.slugs) {
+			t.Errorf("%s should return %v: got %v", tt.url, tt.slugs, slugs)
+			continue
+		}
+		for i := range slugs {
+			if slugs[i] != tt.slugs[i] {
+				t.Errorf("%s should return %v: got %v", tt.url, tt.slugs, slugs)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/models"
+)
+
+type Token struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type TokenJSON struct {
+	Token Token `json:"token"`
+}
+
+type TokensJSON struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// TokensHandler handle /api/user/tokens
+func (h *Handler) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	router := NewRouter(h.Logger)
+	router.AddRoute(
+		`user\/tokens\/?$`,
+		"GET", h.getCurrentUser(h.authorize(h.requireSession(h.getTokens))))
+
+	router.AddRoute(
+		`user\/tokens\/?$`,
+		"POST", h.getCurrentUser(h.authorize(h.requireSession(h.createToken))))
+
+	router.AddRoute(
+		`user\/tokens\/(?P<id>[0-9]+)$`,
+		"DELETE", h.getCurrentUser(h.authorize(h.requireSession(h.revokeToken))))
+
+	router.ServeHTTP(w, r)
+}
+
+// requireSession rejects requests authenticated with a personal access
+// token, so a leaked token can't be used to mint new ones
+func (h *Handler) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return traceStep("requireSession", next, func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if claim, ok := r.Context().Value(Claim).(*auth.Claims); ok && claim.Personal {
+			err := fmt.Errorf("Personal access tokens can't manage tokens")
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getTokens handle GET /api/user/tokens
+func (h *Handler) getTokens(w http.ResponseWriter, r *http.Request) {
+	u := r.Context().Value(CurrentUser).(*models.User)
+
+	tokens, err := h.store(r).FindAPITokens(u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tokensJSON := TokensJSON{Tokens: []Token{}}
+	for i := range tokens {
+		tokensJSON.Tokens = append(tokensJSON.Tokens, buildTokenJSON(&tokens[i], ""))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokensJSON)
+}
+
+// createToken handle POST /api/user/tokens
+func (h *Handler) createToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+		} `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var errs = models.ValidationMessages{}
+	for _, scope := range body.Token.Scopes {
+		if !auth.IsValidScope(scope) {
+			errs["scopes"] = []string{fmt.Sprintf("unknown scope %s", scope)}
+		}
+	}
+
+	if len(errs) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(errorResponse{Errors: errs})
+		return
+	}
+
+	u := r.Context().Value(CurrentUser).(*models.User)
+
+	t, secret, err := models.NewAPIToken(u, body.Token.Name, body.Token.Scopes, auth.PersonalTokenPrefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.store(r).CreateAPIToken(t); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TokenJSON{Token: buildTokenJSON(t, secret)})
+}
+
+// revokeToken handle DELETE /api/user/tokens/:id
+func (h *Handler) revokeToken(w http.ResponseWriter, r *http.Request) {
+	u := r.Context().Value(CurrentUser).(*models.User)
+
+	id, err := strconv.Atoi(r.Context().Value("id").(string))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := h.store(r).RevokeAPIToken(u.ID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func buildTokenJSON(t *models.APIToken, secret string) Token {
+	return Token{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     t.ScopeList(),
+		Token:      secret,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
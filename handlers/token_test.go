@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+)
+
+func createToken(t *testing.T, h *Handler, username string, scopes []string) Token {
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"token": map[string]interface{}{
+			"name":   "script",
+			"scopes": scopes,
+		},
+	})
+	req, err := http.NewRequest("POST", "/api/user/tokens", bytes.NewBuffer(jsonBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := auth.NewJWT().NewToken(username)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.TokensHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusCreated {
+		t.Fatalf("should return a 201 status code: got %v wamt %v", Code, http.StatusCreated)
+	}
+
+	var tokenResponse TokenJSON
+	json.NewDecoder(recorder.Body).Decode(&tokenResponse)
+
+	return tokenResponse.Token
+}
+
+func TestTokensHandler_Create(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	token := createToken(t, h, "user1", []string{auth.ScopeReadArticles})
+
+	if !auth.IsPersonalToken(token.Token) {
+		t.Errorf("should return the token secret: got %v", token.Token)
+	}
+
+	if len(token.Scopes) != 1 || token.Scopes[0] != auth.ScopeReadArticles {
+		t.Errorf("should return the token scopes: got %v wamt %v", token.Scopes, []string{auth.ScopeReadArticles})
+	}
+}
+
+func TestTokensHandler_CreateUnknownScope(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	// read:user and write:comments guard no route
+	for _, scope := range []string{"admin", "read:user", "write:comments"} {
+		jsonBody, _ := json.Marshal(map[string]interface{}{
+			"token": map[string]interface{}{
+				"name":   "script",
+				"scopes": []string{scope},
+			},
+		})
+		req, err := http.NewRequest("POST", "/api/user/tokens", bytes.NewBuffer(jsonBody))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwt := auth.NewJWT().NewToken("user1")
+		req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(h.TokensHandler)
+
+		handler.ServeHTTP(recorder, req)
+
+		if Code := recorder.Code; Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s should return a 422 status code: got %v wamt %v", scope, Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestTokensHandler_ScopeEnforced(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	token := createToken(t, h, "user1", []string{auth.ScopeReadArticles})
+
+	a := articleEntity{
+		Article: article{
+			Title:       "Written With A Read Token",
+			Description: "Description",
+			Body:        "Body",
+		},
+	}
+
+	jsonBody, _ := json.Marshal(a)
+	req, err := http.NewRequest("POST", "/api/articles", bytes.NewBuffer(jsonBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token.Token))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusForbidden {
+		t.Errorf("should return a 403 status code: got %v wamt %v", Code, http.StatusForbidden)
+	}
+}
+
+func TestTokensHandler_ScopeGranted(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	token := createToken(t, h, "user1", []string{auth.ScopeWriteArticles})
+
+	a := articleEntity{
+		Article: article{
+			Title:       "Written With A Write Token",
+			Description: "Description",
+			Body:        "Body",
+		},
+	}
+
+	jsonBody, _ := json.Marshal(a)
+	req, err := http.NewRequest("POST", "/api/articles", bytes.NewBuffer(jsonBody))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token.Token))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.ArticlesHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusCreated {
+		t.Errorf("should return a 201 status code: got %v wamt %v", Code, http.StatusCreated)
+	}
+}
+
+func TestTokensHandler_Revoke(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	token := createToken(t, h, "user2", []string{auth.ScopeWriteArticles})
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/api/user/tokens/%d", token.ID), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := auth.NewJWT().NewToken("user2")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", jwt))
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.TokensHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusNoContent {
+		t.Errorf("should return a 204 status code: got %v wamt %v", Code, http.StatusNoContent)
+	}
+
+	if _, err := h.checkRequest(requestWithToken(token.Token)); err == nil {
+		t.Errorf("revoked token should no longer authenticate")
+	}
+}
+
+func TestTokensHandler_TokenCantManageTokens(t *testing.T) {
+	t.Parallel()
+	h := newTestHandler(t)
+
+	token := createToken(t, h, "user1", []string{auth.ScopeWriteArticles})
+
+	req := requestWithToken(token.Token)
+	req.URL.Path = "/api/user/tokens"
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.TokensHandler)
+
+	handler.ServeHTTP(recorder, req)
+
+	if Code := recorder.Code; Code != http.StatusForbidden {
+		t.Errorf("should return a 403 status code: got %v wamt %v", Code, http.StatusForbidden)
+	}
+}
+
+func requestWithToken(token string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", token))
+	return req
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/JackyChiu/realworld-starter-kit/models"
+	"github.com/JackyChiu/realworld-starter-kit/tracing"
+)
+
+// Trace records a span for every request, continuing the trace of the
+// traceparent header when sent. The span is named after the route matched
+// by the routers, like GET /api/articles/:slug.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			))
+		defer span.End()
+
+		if id := RequestIDFromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		info, r := withRequestInfo(r.WithContext(ctx))
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		status := sw.statusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if info.route != "" {
+			span.SetName(r.Method + " " + info.route)
+			span.SetAttributes(attribute.String("http.route", info.route))
+		}
+		if info.user != "" {
+			span.SetAttributes(attribute.String("enduser.id", info.user))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// traceStep runs a middleware step in a span of its own, ended when the
+// step hands the request to next or answers it. The following steps are
+// siblings of the span, not its children, so each one shows its own time.
+func traceStep(name string, next http.HandlerFunc, step func(http.ResponseWriter, *http.Request, http.HandlerFunc)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parent := trace.SpanFromContext(r.Context())
+		ctx, span := tracing.Tracer().Start(r.Context(), "middleware "+name)
+		defer span.End()
+
+		step(w, r.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			span.End()
+			next(w, r.WithContext(trace.ContextWithSpan(r.Context(), parent)))
+		})
+	}
+}
+
+// store returns the datastore tracing its queries in the span of the request
+func (h *Handler) store(r *http.Request) models.Datastorer {
+	return h.DB.WithContext(r.Context())
+}
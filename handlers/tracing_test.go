@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/JackyChiu/realworld-starter-kit/auth"
+)
+
+func TestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	h := newTestHandler(t)
+	handler := RequestID(Trace(http.HandlerFunc(h.ArticlesHandler)))
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	req, _ := http.NewRequest("GET", "/api/articles/title-1", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", auth.NewJWT().NewToken("user1")))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Other tests may record spans in parallel, only the spans of the
+	// trace are checked
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			spans[span.Name()] = span
+		}
+	}
+
+	server, ok := spans["GET /api/articles/:slug"]
+	if !ok {
+		t.Fatalf("should name the request span after the route: got %v", spans)
+	}
+	if parent := server.Parent().SpanID().String(); parent != spanID {
+		t.Errorf("should continue the trace of traceparent: got %v wamt %v", parent, spanID)
+	}
+
+	for _, name := range []string{"middleware getCurrentUser", "middleware requireScope", "middleware extractArticle"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("should trace %s: got %v", name, spans)
+			continue
+		}
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("%s should be a child of the request span", name)
+		}
+	}
+}
@@ -31,7 +31,7 @@ func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
-		h.Logger.Println(err)
+		h.log(r).Warn("decoding the user", "error", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -39,19 +39,20 @@ func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 
 	m, err := models.NewUser(u.Email, u.Username, u.Password)
 	if err != nil {
-		h.Logger.Println(err)
+		h.log(r).Info("invalid user", "error", err)
 		// TODO: Error JSON
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	err = h.DB.CreateUser(m)
+	err = h.store(r).CreateUser(m)
 	if err != nil {
-		h.Logger.Println(err)
+		h.log(r).Info("registration failed", "username", u.Username, "error", err)
 		// TODO: Error JSON
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
+	h.Metrics.Registrations.Inc()
 
 	res := &UserJSON{
 		&User{
@@ -73,15 +74,15 @@ func (h *Handler) LoginUser(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
-		h.Logger.Println(err)
+		h.log(r).Warn("decoding the user", "error", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	defer r.Body.Close()
 
-	m, err := h.DB.FindUserByEmail(u.Email)
+	m, err := h.store(r).FindUserByEmail(u.Email)
 	if err != nil {
-		h.Logger.Println(err)
+		h.log(r).Info("login failed", "error", err)
 		// TODO: Error JSON
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
@@ -90,10 +91,19 @@ func (h *Handler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	match := m.MatchPassword(u.Password)
 	if !match {
 		// TODO: Error JSON
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		http.Error(w, "Invalid email or password", http.StatusUnprocessableEntity)
 		return
 	}
 
+	if m.PasswordNeedsRehash() {
+		if err := m.SetPassword(u.Password); err != nil {
+			h.log(r).Error("rehashing password", "user", m.ID, "error", err)
+		} else if err := h.store(r).UpdatePassword(m); err != nil {
+			h.log(r).Error("rehashing password", "user", m.ID, "error", err)
+		}
+	}
+	h.Metrics.Logins.Inc()
+
 	res := &UserJSON{
 		&User{
 			Username: m.Username,
@@ -1,41 +1,333 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/JackyChiu/realworld-starter-kit/auth"
+	"github.com/JackyChiu/realworld-starter-kit/cache"
 	"github.com/JackyChiu/realworld-starter-kit/handlers"
 	"github.com/JackyChiu/realworld-starter-kit/models"
+	"github.com/JackyChiu/realworld-starter-kit/tracing"
 )
 
 const (
-	DATABASE string = "conduit.db"
-	DIALECT  string = "sqlite3"
-	PORT     string = ":8080"
+	PORT             string        = ":8080"
+	SHUTDOWN_TIMEOUT time.Duration = 10 * time.Second
 )
 
 func main() {
-	logger := log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+	logger, err := newLogger(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	db, err := models.NewDB(DIALECT, DATABASE)
+	var cost int
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		if cost, err = strconv.Atoi(v); err != nil {
+			fatal(logger, fmt.Errorf("Invalid BCRYPT_COST: %s", v))
+		}
+	}
+	hasher, err := models.NewPasswordHasher(os.Getenv("PASSWORD_HASHER"), cost)
 	if err != nil {
-		logger.Fatal(err)
+		fatal(logger, err)
 	}
+	models.PasswordHasher = hasher
 
-	db.InitSchema()
+	config, err := models.ConfigFromEnv()
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	db, err := models.Open(config)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(db, os.Args[2:]); err != nil {
+			fatal(logger, err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "tags" {
+		if err := tags(db, os.Args[2:]); err != nil {
+			fatal(logger, err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := db.ReconcileFavoritesCounts(); err != nil {
+			fatal(logger, err)
+		}
+		return
+	}
+
+	if err := db.InitSchema(); err != nil {
+		fatal(logger, err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), os.Getenv("OTEL_TRACES_EXPORTER"))
+	if err != nil {
+		fatal(logger, err)
+	}
+	// gorm callbacks can't be registered while queries run, they are all
+	// set before the background jobs and the server start
+	db.TraceQueries(tracing.Tracer())
+	metrics := handlers.NewMetrics()
+	db.InstrumentQueries(metrics.ObserveQuery)
+
+	retention := 30 * 24 * time.Hour
+	if v := os.Getenv("ARTICLE_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil {
+			fatal(logger, err)
+		}
+	}
+	go runEvery(time.Hour, logger, "purging deleted articles", func() (int, error) {
+		return db.PurgeArticles(time.Now().Add(-retention))
+	})
+	go runEvery(time.Minute, logger, "publishing scheduled articles", func() (int, error) {
+		return db.PublishScheduledArticles(time.Now())
+	})
+
+	var store models.Datastorer = db
+	if v := os.Getenv("CACHE_URL"); v != "none" {
+		c, err := cache.Open(v)
+		if err != nil {
+			fatal(logger, err)
+		}
+		cached := models.NewCachedStore(db, c)
+		cached.OnError = func(err error) { logger.Warn("cache error", "error", err) }
+		if v := os.Getenv("CACHE_TTL"); v != "" {
+			if cached.TTL, err = time.ParseDuration(v); err != nil {
+				fatal(logger, err)
+			}
+		}
+		store = cached
+	}
 
 	j := auth.NewJWT()
-	h := handlers.New(db, j, logger)
+	h := handlers.New(store, j, logger)
+	h.Metrics = metrics
+	if retention < h.RestoreWindow {
+		h.RestoreWindow = retention
+	}
+	if v := os.Getenv("TRENDING_WINDOW"); v != "" {
+		if h.TrendingWindow, err = time.ParseDuration(v); err != nil {
+			fatal(logger, err)
+		}
+	}
+	for group := range handlers.DefaultRateLimits {
+		v := os.Getenv("RATE_LIMIT_" + strings.ToUpper(group))
+		if v == "off" {
+			delete(h.RateLimits, group)
+		} else if v != "" {
+			if h.RateLimits[group], err = handlers.ParseRateLimit(v); err != nil {
+				fatal(logger, err)
+			}
+		}
+	}
+	h.TrustProxy = os.Getenv("TRUST_PROXY") == "true"
 
 	http.HandleFunc("/api/users", h.UsersHandler)
 	http.HandleFunc("/api/users/login", h.LoginHandler)
 	http.HandleFunc("/api/articles", h.ArticlesHandler)
 	http.HandleFunc("/api/articles/", h.ArticlesHandler)
+	http.HandleFunc("/api/search", h.SearchHandler)
+	http.HandleFunc("/api/user/tokens", h.TokensHandler)
+	http.HandleFunc("/api/user/tokens/", h.TokensHandler)
+	http.HandleFunc("/metrics", h.MetricsHandler)
 
-	err = http.ListenAndServe(PORT, nil)
+	cors, err := corsConfig()
 	if err != nil {
-		logger.Fatal(err)
+		fatal(logger, err)
+	}
+
+	// Preflight requests are answered before reaching the routers, and
+	// logged, measured and traced along with the other requests
+	server := handlers.RequestID(handlers.Trace(h.AccessLog(h.Instrument(handlers.CORS(cors, http.DefaultServeMux)))))
+	srv := &http.Server{Addr: PORT, Handler: server}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("listening", "addr", PORT)
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	select {
+	case err = <-errc:
+		shutdownTracing(context.Background())
+		fatal(logger, err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// The requests in flight are finished before the spans left are flushed
+	logger.Info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != nil {
+		logger.Error("shutting down the server", "error", err)
+	}
+	if err = shutdownTracing(ctx); err != nil {
+		logger.Error("flushing the traces", "error", err)
+	}
+}
+
+// migrate handle the `migrate up|down [steps]|status` subcommand
+func migrate(db *models.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s migrate up|down [steps]|status", os.Args[0])
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := db.MigrateUp()
+		fmt.Printf("applied %d migration(s)\n", n)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("Invalid number of steps: %s", args[1])
+			}
+		}
+		n, err := db.MigrateDown(steps)
+		fmt.Printf("reverted %d migration(s)\n", n)
+		return err
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			if m.Applied {
+				fmt.Printf("%04d %-30s applied %s\n", m.Version, m.Name, m.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%04d %-30s pending\n", m.Version, m.Name)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Unknown migrate command: %s", args[0])
+}
+
+// tags handle the `tags alias <alias> <tag>|merge <from> <into>` subcommand
+func tags(db *models.DB, args []string) error {
+	usage := fmt.Errorf("usage: %s tags alias <alias> <tag>|merge <from> <into>", os.Args[0])
+	if len(args) != 3 {
+		return usage
+	}
+
+	switch args[0] {
+	case "alias":
+		if err := db.CreateTagAlias(args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("%q is now an alias of %q\n", models.NormalizeTagName(args[1]), models.NormalizeTagName(args[2]))
+		return nil
+	case "merge":
+		tag, err := db.MergeTags(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("merged %q into %q, now used by %d article(s)\n", models.NormalizeTagName(args[1]), tag.Name, tag.TaggingsCount)
+		return nil
+	}
+
+	return usage
+}
+
+// corsConfig reads the CORS settings from CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS, CORS_ALLOW_CREDENTIALS and
+// CORS_MAX_AGE, keeping the defaults of the unset ones
+func corsConfig() (handlers.CORSConfig, error) {
+	c := handlers.DefaultCORSConfig
+
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		c.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("CORS_ALLOWED_METHODS"); v != "" {
+		c.AllowedMethods = splitList(strings.ToUpper(v))
+	}
+	if v := os.Getenv("CORS_ALLOWED_HEADERS"); v != "" {
+		c.AllowedHeaders = splitList(v)
 	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		var err error
+		if c.AllowCredentials, err = strconv.ParseBool(v); err != nil {
+			return c, fmt.Errorf("Invalid CORS_ALLOW_CREDENTIALS: %v", err)
+		}
+	}
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		var err error
+		if c.MaxAge, err = time.ParseDuration(v); err != nil {
+			return c, fmt.Errorf("Invalid CORS_MAX_AGE: %v", err)
+		}
+	}
+
+	return c, nil
+}
+
+// splitList splits a comma separated setting
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// runEvery calls task at every interval, logging its errors and
+// the number of processed rows under name
+func runEvery(interval time.Duration, logger *slog.Logger, name string, task func() (int, error)) {
+	for {
+		n, err := task()
+		if err != nil {
+			logger.Error(name, "error", err)
+		} else if n > 0 {
+			logger.Info(name, "count", n)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// newLogger returns the logger configured by LOG_LEVEL, one of debug, info
+// (default), warn and error, and LOG_FORMAT, json (default) or text
+func newLogger(level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("Invalid LOG_LEVEL: %s", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, opts)), nil
+	}
+	return nil, fmt.Errorf("Invalid LOG_FORMAT: %s", format)
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, err error) {
+	logger.Error(err.Error())
+	os.Exit(1)
 }
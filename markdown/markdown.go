@@ -0,0 +1,104 @@
+// Package markdown renders user written Markdown to sanitized HTML
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// DefaultCacheSize is the number of rendered documents kept by a Renderer
+const DefaultCacheSize = 1024
+
+var (
+	md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	// policy allows the elements produced by CommonMark and GFM, links are
+	// forced to nofollow and code blocks keep their language class
+	policy = func() *bluemonday.Policy {
+		p := bluemonday.UGCPolicy()
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+		p.AllowAttrs("type", "checked", "disabled").OnElements("input")
+		p.RequireNoFollowOnLinks(true)
+		return p
+	}()
+)
+
+// Render converts CommonMark with the GFM extensions (tables, fenced code,
+// strikethrough, task lists and autolinks) to HTML safe to embed in a page
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Renderer renders Markdown and keeps the most recently used results.
+// Callers pick cache keys that change whenever the source does, such as
+// an article id and revision number, so entries never need invalidating.
+type Renderer struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type entry struct {
+	key  string
+	html string
+}
+
+// NewRenderer returns a Renderer caching up to size documents
+func NewRenderer(size int) *Renderer {
+	return &Renderer{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Render returns the HTML of source, rendering it only if nothing is
+// cached under key
+func (r *Renderer) Render(key, source string) (string, error) {
+	r.mu.Lock()
+	if el, ok := r.items[key]; ok {
+		r.ll.MoveToFront(el)
+		r.mu.Unlock()
+		return el.Value.(*entry).html, nil
+	}
+	r.mu.Unlock()
+
+	html, err := Render(source)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if el, ok := r.items[key]; ok {
+		r.ll.MoveToFront(el)
+		return html, nil
+	}
+
+	r.items[key] = r.ll.PushFront(&entry{key, html})
+	for r.size > 0 && r.ll.Len() > r.size {
+		oldest := r.ll.Back()
+		r.ll.Remove(oldest)
+		delete(r.items, oldest.Value.(*entry).key)
+	}
+	return html, nil
+}
+
+// Len returns the number of cached documents
+func (r *Renderer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ll.Len()
+}
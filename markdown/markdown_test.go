@@ -0,0 +1,108 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contains []string
+		excludes []string
+	}{
+		{
+			"emphasis",
+			"Some *emphasis* and **strong** text",
+			[]string{"<em>emphasis</em>", "<strong>strong</strong>"},
+			nil,
+		},
+		{
+			"fenced code",
+			"```go\nfmt.Println(\"<hi>\")\n```",
+			[]string{`<code class="language-go">`, "&lt;hi&gt;"},
+			nil,
+		},
+		{
+			"table",
+			"| a | b |\n|---|---|\n| 1 | 2 |",
+			[]string{"<table>", "<th>a</th>", "<td>2</td>"},
+			nil,
+		},
+		{
+			"raw html",
+			"<script>alert(1)</script><img src=x onerror=alert(1)>",
+			nil,
+			[]string{"<script", "onerror"},
+		},
+		{
+			"javascript link",
+			"[click](javascript:alert(1))",
+			nil,
+			[]string{"javascript:"},
+		},
+		{
+			"links",
+			"[conduit](https://example.com)",
+			[]string{`href="https://example.com"`, `rel="nofollow"`},
+			nil,
+		},
+		{
+			"code class",
+			"```\" onmouseover=\"alert(1)\nx\n```",
+			nil,
+			[]string{"onmouseover"},
+		},
+	}
+
+	for _, tt := range tests {
+		html, err := Render(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range tt.contains {
+			if !strings.Contains(html, s) {
+				t.Errorf("%s: should contain %q: got %q", tt.name, s, html)
+			}
+		}
+
+		for _, s := range tt.excludes {
+			if strings.Contains(html, s) {
+				t.Errorf("%s: should not contain %q: got %q", tt.name, s, html)
+			}
+		}
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	r := NewRenderer(2)
+
+	html, _ := r.Render("a@1", "*one*")
+	if html != "<p><em>one</em></p>\n" {
+		t.Errorf("should render the source: got %q", html)
+	}
+
+	// The key is what identifies a document, its source is only rendered once
+	html, _ = r.Render("a@1", "*changed*")
+	if html != "<p><em>one</em></p>\n" {
+		t.Errorf("should return the cached html: got %q", html)
+	}
+
+	r.Render("b@1", "two")
+	r.Render("a@1", "*one*")
+	r.Render("c@1", "three")
+
+	if n := r.Len(); n != 2 {
+		t.Errorf("should keep at most 2 documents: got %v wamt %v", n, 2)
+	}
+
+	if _, ok := r.items["b@1"]; ok {
+		t.Errorf("should evict the least recently used document")
+	}
+
+	if _, ok := r.items["a@1"]; !ok {
+		t.Errorf("should keep the recently used document")
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("http_requests_total", "Requests handled.", "method", "route")
+	inFlight := r.NewGauge("http_requests_in_flight", "Requests being handled.")
+	durations := r.NewHistogram("http_request_duration_seconds", "Request durations.", []float64{1, 0.1}, "route")
+
+	requests.Inc("GET", "/api/articles")
+	requests.Inc("GET", "/api/articles")
+	requests.Add(0.5, "POST", `/api/"quoted"\path`)
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	durations.Observe(0.05, "/api/articles")
+	durations.Observe(0.1, "/api/articles")
+	durations.Observe(3, "/api/articles")
+
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != b.Len() {
+		t.Errorf("should return the bytes written: got %v want %v", n, b.Len())
+	}
+
+	want := `# HELP http_requests_total Requests handled.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/api/articles"} 2
+http_requests_total{method="POST",route="/api/\"quoted\"\\path"} 0.5
+# HELP http_requests_in_flight Requests being handled.
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight 1
+# HELP http_request_duration_seconds Request durations.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="/api/articles",le="0.1"} 2
+http_request_duration_seconds_bucket{route="/api/articles",le="1"} 2
+http_request_duration_seconds_bucket{route="/api/articles",le="+Inf"} 3
+http_request_duration_seconds_sum{route="/api/articles"} 3.15
+http_request_duration_seconds_count{route="/api/articles"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("should write the text format: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("logins_total", "Logins.").Inc()
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := recorder.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("should serve the text format: got %q want %q", ct, ContentType)
+	}
+	if Code := recorder.Code; Code != http.StatusOK {
+		t.Errorf("should return a 200 status code: got %v want %v", Code, http.StatusOK)
+	}
+	if !strings.Contains(recorder.Body.String(), "logins_total 1\n") {
+		t.Errorf("should write the metrics: got %q", recorder.Body.String())
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Requests.", "route")
+
+	for name, f := range map[string]func(){
+		"twice":          func() { r.NewCounter("requests_total", "Requests.") },
+		"labels":         func() { c.Inc() },
+		"negative count": func() { c.Add(-1, "/") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s should panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
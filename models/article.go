@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/Machiel/slugify"
@@ -11,7 +12,10 @@ import (
 type ArticleStorer interface {
 	CreateArticle(*Article) error
 	DeleteArticle(*Article) error
-	GetAllArticles() *gorm.DB
+	GetDeletedArticle(string) (*Article, error)
+	RestoreArticle(*Article) error
+	PurgeArticles(time.Time) (int, error)
+	GetArticles(ArticleQuery) ([]Article, error)
 	GetAllArticlesAuthoredBy(string) ([]Article, error)
 	GetAllArticlesFavoritedBy(string) ([]Article, error)
 	GetAllArticlesWithTag(string) ([]Article, error)
@@ -21,9 +25,23 @@ type ArticleStorer interface {
 	FindUserByUsername(string) (*User, error)
 	IsFavorited(int, int) bool
 	IsFollowing(int, int) bool
+	FavoritedArticleIDs(int, []int) (map[int]bool, error)
+	FollowedUserIDs(int, []int) (map[int]bool, error)
 	SaveArticle(*Article) error
+	ReconcileFavoritesCounts() error
+	PublishScheduledArticles(time.Time) (int, error)
 }
 
+var (
+	errAlreadyFavorited = fmt.Errorf("This article is already in your favorites !")
+	errNotFavorited     = fmt.Errorf("Cannot remove this article from your favorites. This article is not in your favorites !")
+	errSlugTaken        = fmt.Errorf("Another article already uses this slug")
+)
+
+// ErrVersionConflict is returned when saving or deleting an article that
+// was changed since it was read
+var ErrVersionConflict = fmt.Errorf("The article was changed since it was read")
+
 // Article the article model
 type Article struct {
 	ID             int
@@ -31,13 +49,53 @@ type Article struct {
 	Title          string
 	Description    string
 	Body           string
-	User           User
+	User           User `gorm:"association_autoupdate:false"`
 	UserID         int
 	Tags           []Tag `gorm:"many2many:taggings;"`
 	Favorites      []Favorite
 	FavoritesCount int
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
+	DeletedAt      *time.Time `sql:"index"`
+	Status         string     `sql:"index"`
+	PublishAt      *time.Time
+	PublishedAt    *time.Time
+	Revision       int
+	// Version is incremented by every SaveArticle, saving or deleting a
+	// stale copy of the article fails with ErrVersionConflict
+	Version int
+}
+
+// Article statuses. Drafts and scheduled articles are only visible to their
+// author, unlisted articles are reachable by slug but left out of lists.
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusUnlisted  = "unlisted"
+)
+
+// ArticleQuery filters and paginates article lists. Zero values
+// disable the matching filter.
+type ArticleQuery struct {
+	// ViewerID also lists the unpublished articles of this user
+	ViewerID int
+	// Tags lists articles tagged with any of them, or all of them when
+	// AllTags is set. Articles tagged with any of ExcludedTags are left out.
+	Tags         []string
+	AllTags      bool
+	ExcludedTags []string
+	Author       string
+	FavoritedBy  string
+	// Since and Until bound the creation time, both inclusive
+	Since time.Time
+	Until time.Time
+	// Sort is one of Sorts, newest first by default
+	Sort string
+	// TrendingWindow overrides DefaultTrendingWindow for SortTrending
+	TrendingWindow time.Duration
+	Limit          int
+	Offset         int
 }
 
 type ValidationMessages map[string]interface{}
@@ -49,6 +107,7 @@ func NewArticle(title string, description string, body string, user *User) *Arti
 		Description: description,
 		Body:        body,
 		User:        *user,
+		Status:      StatusPublished,
 	}
 }
 
@@ -72,30 +131,194 @@ func (a *Article) IsValid() (bool, map[string]interface{}) {
 		valid = false
 	}
 
+	switch a.Status {
+	case StatusDraft, StatusPublished, StatusUnlisted:
+	case StatusScheduled:
+		if a.PublishAt == nil {
+			errs["publishAt"] = []string{"publishAt field can't be blank for a scheduled article"}
+			valid = false
+		}
+	default:
+		errs["status"] = []string{fmt.Sprintf("status must be one of %s, %s, %s or %s",
+			StatusDraft, StatusScheduled, StatusPublished, StatusUnlisted)}
+		valid = false
+	}
+
 	return valid, errs
 }
 
+// IsVisibleTo check if the user can read the article
+func (a *Article) IsVisibleTo(userID int) bool {
+	return a.Status == StatusPublished || a.Status == StatusUnlisted || a.UserID == userID
+}
+
+// setPublishedAt records when the article was first published
+func (a *Article) setPublishedAt() {
+	if a.Status == "" {
+		a.Status = StatusPublished
+	}
+
+	if a.Status != StatusDraft && a.Status != StatusScheduled && a.PublishedAt == nil {
+		now := time.Now()
+		a.PublishedAt = &now
+	}
+}
+
 // IsOwnedBy check if the article is owned by the given username
 func (a *Article) IsOwnedBy(username string) bool {
 	return a.User.Username == username
 }
 
-// CreateArticle persist a new article
-func (db *DB) CreateArticle(article *Article) (err error) {
-	err = db.Create(&article).Error
-	return
+// CreateArticle persist a new article and its first revision
+func (db *DB) CreateArticle(article *Article) error {
+	return db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+		if err := tx.Create(&article).Error; err != nil {
+			return err
+		}
+		if err := tx.createRevision(article); err != nil {
+			return err
+		}
+		if err := tx.recountArticleTags(article.ID); err != nil {
+			return err
+		}
+		return tx.indexArticle(article)
+	})
 }
 
-// DeleteArticle persist a new article
-func (db *DB) DeleteArticle(article *Article) (err error) {
-	err = db.Delete(&article).Error
-	return
+// DeleteArticle soft deletes an article, it is hidden from every query
+// until it is restored or purged.
+func (db *DB) DeleteArticle(article *Article) error {
+	return db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+		res := tx.Where("version = ?", article.Version).Delete(&article)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Deleting a deleted article is a no-op
+			var n int
+			if err := tx.Model(&Article{}).Where("id = ?", article.ID).Count(&n).Error; err != nil || n == 0 {
+				return err
+			}
+			return ErrVersionConflict
+		}
+		if err := tx.recountArticleTags(article.ID); err != nil {
+			return err
+		}
+		return tx.unindexArticle(article.ID)
+	})
 }
 
-// SaveArticle save an article to the database.
-func (db *DB) SaveArticle(article *Article) (err error) {
-	err = db.Save(&article).Error
-	return
+// GetDeletedArticle retrieve the last soft deleted article with the slug
+func (db *DB) GetDeletedArticle(slug string) (*Article, error) {
+	var article Article
+	err := db.Unscoped().
+		Preload("Tags").
+		Preload("User").
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at desc").
+		First(&article, "slug = ?", slug).Error
+	return &article, err
+}
+
+// RestoreArticle brings back a soft deleted article
+func (db *DB) RestoreArticle(article *Article) error {
+	if _, err := db.GetArticle(article.Slug); err == nil {
+		return errSlugTaken
+	}
+
+	return db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+		err := tx.Unscoped().Model(article).UpdateColumn("deleted_at", gorm.Expr("NULL")).Error
+		if err != nil {
+			return err
+		}
+		article.DeletedAt = nil
+		if err := tx.recountArticleTags(article.ID); err != nil {
+			return err
+		}
+		return tx.indexArticle(article)
+	})
+}
+
+// articleDependents lists the tables referencing articles.id, their rows
+// are deleted along with the article when it is purged
+var articleDependents = []string{"taggings", "favorites", "article_revisions"}
+
+// PurgeArticles permanently deletes the articles soft deleted before the
+// given time and returns how many were purged
+func (db *DB) PurgeArticles(deletedBefore time.Time) (int, error) {
+	var ids []int
+	err := db.Unscoped().Model(&Article{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	err = db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+		tagIDs, err := tx.articleTagIDs(ids...)
+		if err != nil {
+			return err
+		}
+		for _, table := range articleDependents {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE article_id IN (?)", ids).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Where("id IN (?)", ids).Delete(&Article{}).Error; err != nil {
+			return err
+		}
+		return tx.recountTags(tagIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// SaveArticle save an article to the database and records a revision.
+// The article version is bumped with a conditional UPDATE so saving a
+// stale copy fails with ErrVersionConflict. The favorites count is only
+// maintained by FavoriteArticle and UnfavoriteArticle. The author isn't
+// saved with the article, cached copies carry it without its password.
+func (db *DB) SaveArticle(article *Article) error {
+	version := article.Version
+	err := db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+
+		// The row stays locked until the transaction ends, a concurrent
+		// save of the same version waits and then matches no row
+		res := tx.Model(&Article{}).
+			Where("id = ? AND version = ?", article.ID, article.Version).
+			UpdateColumn("version", gorm.Expr("version + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		article.Version++
+
+		if err := tx.Omit("favorites_count").Save(&article).Error; err != nil {
+			return err
+		}
+		if err := tx.createRevision(article); err != nil {
+			return err
+		}
+		if err := tx.recountArticleTags(article.ID); err != nil {
+			return err
+		}
+		return tx.indexArticle(article)
+	})
+	if err != nil {
+		// Rolled back, the article is still at the version it was read
+		article.Version = version
+	}
+	return err
 }
 
 // GetArticle retrieve an article by it slug
@@ -105,35 +328,90 @@ func (db *DB) GetArticle(slug string) (*Article, error) {
 	return &article, err
 }
 
-// GetAllArticles returns all articles.
-func (db *DB) GetAllArticles() *gorm.DB {
-	return db.Scopes(defaultScope)
-}
+// GetArticles returns the articles matching the query in the q.Sort order.
+func (db *DB) GetArticles(q ArticleQuery) (articles []Article, err error) {
+	query := db.Scopes(defaultScope).
+		Where("articles.status = ? OR articles.user_id = ?", StatusPublished, q.ViewerID)
+
+	if len(q.Tags) > 0 {
+		var names []string
+		if names, err = db.canonicalTagNames(q.Tags); err != nil {
+			return
+		}
+
+		tagged := db.Table("taggings").
+			Select("taggings.article_id").
+			Joins("JOIN tags ON tags.id = taggings.tag_id").
+			Where("tags.name IN (?)", names)
+		if q.AllTags {
+			tagged = tagged.Group("taggings.article_id").Having("COUNT(DISTINCT tags.id) = ?", len(names))
+		}
+		query = query.Where("articles.id IN ?", tagged.SubQuery())
+	}
+
+	if len(q.ExcludedTags) > 0 {
+		var names []string
+		if names, err = db.canonicalTagNames(q.ExcludedTags); err != nil {
+			return
+		}
+
+		query = query.Where("articles.id NOT IN ?", db.Table("taggings").
+			Select("taggings.article_id").
+			Joins("JOIN tags ON tags.id = taggings.tag_id").
+			Where("tags.name IN (?)", names).
+			SubQuery())
+	}
+
+	if !q.Since.IsZero() {
+		query = query.Where("articles.created_at >= ?", q.Since)
+	}
+
+	if !q.Until.IsZero() {
+		query = query.Where("articles.created_at <= ?", q.Until)
+	}
+
+	if q.Author != "" {
+		query = query.Where("articles.user_id IN ?", db.Table("users").
+			Select("users.id").
+			Where("users.username = ?", q.Author).
+			SubQuery())
+	}
+
+	if q.FavoritedBy != "" {
+		query = query.Where("articles.id IN ?", db.Table("favorites").
+			Select("favorites.article_id").
+			Joins("JOIN users ON users.id = favorites.user_id").
+			Where("users.username = ?", q.FavoritedBy).
+			SubQuery())
+	}
+
+	query = db.sortArticles(query, q)
 
-func (db *DB) GetAllArticlesWithTag(tagName string) (articles []Article, err error) {
-	err = db.Scopes(defaultScope).
-		Joins("JOIN taggings ON taggings.article_id = articles.id").
-		Joins("JOIN tags ON tags.id = taggings.tag_id").
-		Where("tags.name = ?", tagName).
-		Find(&articles).Error
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	} else if q.Offset > 0 {
+		// SQLite and MySQL only accept an OFFSET after a LIMIT
+		query = query.Limit(math.MaxInt32)
+	}
+
+	if q.Offset > 0 {
+		query = query.Offset(q.Offset)
+	}
+
+	err = query.Find(&articles).Error
 	return
 }
 
-func (db *DB) GetAllArticlesAuthoredBy(username string) (articles []Article, err error) {
-	err = db.Scopes(defaultScope).
-		Joins("JOIN users ON users.id = articles.user_id").
-		Where("users.username = ?", username).
-		Find(&articles).Error
-	return
+func (db *DB) GetAllArticlesWithTag(tagName string) ([]Article, error) {
+	return db.GetArticles(ArticleQuery{Tags: []string{tagName}})
 }
 
-func (db *DB) GetAllArticlesFavoritedBy(username string) (articles []Article, err error) {
-	err = db.Scopes(defaultScope).
-		Joins("JOIN favorites ON favorites.article_id = articles.id").
-		Joins("JOIN users ON users.id = favorites.user_id").
-		Where("users.username = ?", username).
-		Find(&articles).Error
-	return
+func (db *DB) GetAllArticlesAuthoredBy(username string) ([]Article, error) {
+	return db.GetArticles(ArticleQuery{Author: username})
+}
+
+func (db *DB) GetAllArticlesFavoritedBy(username string) ([]Article, error) {
+	return db.GetArticles(ArticleQuery{FavoritedBy: username})
 }
 
 func (db *DB) IsFavorited(userID int, articleID int) bool {
@@ -149,56 +427,133 @@ func (db *DB) IsFollowing(userIDFrom int, userIDTo int) bool {
 	return false
 }
 
+// FavoritedArticleIDs returns which of the articles the user favorited
+func (db *DB) FavoritedArticleIDs(userID int, articleIDs []int) (map[int]bool, error) {
+	favorited := make(map[int]bool)
+	if userID == 0 || len(articleIDs) == 0 {
+		return favorited, nil
+	}
+
+	var ids []int
+	err := db.Model(&Favorite{}).
+		Where("user_id = ? AND article_id IN (?)", userID, articleIDs).
+		Pluck("article_id", &ids).Error
+
+	for _, id := range ids {
+		favorited[id] = true
+	}
+	return favorited, err
+}
+
+// FollowedUserIDs returns which of the users are followed by the user
+func (db *DB) FollowedUserIDs(userIDFrom int, userIDs []int) (map[int]bool, error) {
+	// TODO: following is not stored yet, see IsFollowing
+	return make(map[int]bool), nil
+}
+
 func (db *DB) FindUserByUsername(username string) (*User, error) {
 	var user User
 	err := db.First(&user, "username = ?", username).Error
 	return &user, err
 }
 
+// FavoriteArticle records the favorite and increments the article
+// favorites count in a single transaction
 func (db *DB) FavoriteArticle(userID int, articleID int) error {
-	var err error
-	f := Favorite{UserID: userID, ArticleID: articleID}
+	err := db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+
+		if tx.IsFavorited(userID, articleID) {
+			return errAlreadyFavorited
+		}
+
+		if err := tx.Create(&Favorite{UserID: userID, ArticleID: articleID}).Error; err != nil {
+			return err
+		}
 
-	if !db.IsFavorited(userID, articleID) {
-		err = db.Create(&f).Error
-	} else {
-		err = fmt.Errorf("This article is already in your favorites !")
+		return tx.incrementFavoritesCount(articleID, 1)
+	})
+
+	// A concurrent request may have favorited the article after the check
+	if IsConflict(err) {
+		err = errAlreadyFavorited
 	}
 
 	return err
 }
 
+// UnfavoriteArticle removes the favorite and decrements the article
+// favorites count in a single transaction
 func (db *DB) UnfavoriteArticle(userID int, articleID int) error {
-	var err error
-	f := Favorite{UserID: userID, ArticleID: articleID}
+	return db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
 
-	if db.IsFavorited(userID, articleID) {
-		err = db.Delete(&f).Error
-	} else {
-		err = fmt.Errorf("Cannot remove this article from your favorites. This article is not in your favorites !")
-	}
+		res := tx.Where("user_id = ? AND article_id = ?", userID, articleID).Delete(&Favorite{})
+		if res.Error != nil {
+			return res.Error
+		}
 
-	return err
+		if res.RowsAffected == 0 {
+			return errNotFavorited
+		}
+
+		return tx.incrementFavoritesCount(articleID, -1)
+	})
+}
+
+func (db *DB) incrementFavoritesCount(articleID int, n int) error {
+	return db.Model(&Article{}).
+		Where("id = ?", articleID).
+		UpdateColumn("favorites_count", gorm.Expr("favorites_count + ?", n)).Error
+}
+
+// PublishScheduledArticles publishes the scheduled articles whose publish
+// time has come and returns how many were published
+func (db *DB) PublishScheduledArticles(now time.Time) (int, error) {
+	res := db.Model(&Article{}).
+		Where("status = ? AND publish_at <= ?", StatusScheduled, now).
+		UpdateColumns(map[string]interface{}{
+			"status":       StatusPublished,
+			"published_at": gorm.Expr("publish_at"),
+		})
+	return int(res.RowsAffected), res.Error
+}
+
+// ReconcileFavoritesCounts recomputes every article favorites count
+// from the favorites table
+func (db *DB) ReconcileFavoritesCounts() error {
+	return db.Exec(reconcileFavoritesCountsSQL).Error
 }
 
+const reconcileFavoritesCountsSQL = `UPDATE articles SET favorites_count = (
+	SELECT COUNT(*) FROM favorites WHERE favorites.article_id = articles.id
+)`
+
 // Callbacks
 
 // BeforeCreate gorm callback
 func (a *Article) BeforeCreate() (err error) {
 	a.Slug = slugify.Slugify(a.Title)
+	if a.Version == 0 {
+		a.Version = 1
+	}
+	a.setPublishedAt()
 	return
 }
 
 func (a *Article) BeforeUpdate() (err error) {
 	a.Slug = slugify.Slugify(a.Title)
+	a.setPublishedAt()
 	return
 }
 
 // Scopes
 
-// Order articles by created_at DESC eager loading Tags and User
+// Order articles by created_at DESC eager loading Tags and User.
+// Soft deleted articles are left out by gorm since Article has a DeletedAt.
 func defaultScope(db *gorm.DB) *gorm.DB {
 	return db.Order("articles.created_at desc").
+		Order("articles.id desc").
 		Preload("Tags").
 		Preload("User")
 }
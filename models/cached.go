@@ -0,0 +1,258 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/JackyChiu/realworld-starter-kit/cache"
+)
+
+// DefaultCacheTTL is how long CachedStore keeps an entry
+const DefaultCacheTTL = time.Minute
+
+// Keys of the CachedStore entries. Articles are cached by id so writes
+// knowing only the id, like FavoriteArticle, can invalidate them, and
+// slugs are mapped to ids.
+const tagsCacheKey = "tags"
+
+func articleCacheKey(id int) string {
+	return fmt.Sprintf("article/%d", id)
+}
+
+func articleSlugCacheKey(slug string) string {
+	return "article-slug/" + slug
+}
+
+// CachedStore decorates a Datastorer with a cache of GetArticle and
+// FindTags. Writes going through the store invalidate the entries they
+// change, writes made in a transaction once it ends. Scheduled articles
+// are not cached since they are published by a background job, other
+// changes made around the store, like ReconcileFavoritesCounts, show once
+// the entries expire after TTL.
+// Cached articles don't keep the password hash of their author.
+type CachedStore struct {
+	Datastorer
+	Cache cache.Cache
+	TTL   time.Duration
+	// OnError is called with the cache errors, reads then fall back to
+	// the store
+	OnError func(error)
+
+	// pending collects the keys invalidated in a transaction, it is only
+	// set on the stores handed to WithTx callbacks
+	pending *[]string
+}
+
+// NewCachedStore returns s cached in c for DefaultCacheTTL
+func NewCachedStore(s Datastorer, c cache.Cache) *CachedStore {
+	return &CachedStore{Datastorer: s, Cache: c, TTL: DefaultCacheTTL}
+}
+
+// GetArticle returns the cached article with the slug, reading and
+// caching it on a miss
+func (c *CachedStore) GetArticle(slug string) (*Article, error) {
+	// Transactions see their own writes, not the cache
+	if c.pending != nil {
+		return c.Datastorer.GetArticle(slug)
+	}
+
+	var article Article
+	if id, ok := c.get(articleSlugCacheKey(slug)); ok {
+		// The slug may have moved to another article since
+		if n, err := strconv.Atoi(string(id)); err == nil &&
+			c.decode(articleCacheKey(n), &article) && article.Slug == slug {
+			return &article, nil
+		}
+	}
+
+	a, err := c.Datastorer.GetArticle(slug)
+	if err != nil || a.Status == StatusScheduled {
+		return a, err
+	}
+
+	cached := *a
+	cached.User.Password = ""
+	c.encode(articleCacheKey(a.ID), cached)
+	c.set(articleSlugCacheKey(slug), []byte(strconv.Itoa(a.ID)))
+	return a, nil
+}
+
+// FindTags returns the cached tags, reading and caching them on a miss
+func (c *CachedStore) FindTags(tags *[]Tag) error {
+	if c.pending != nil {
+		return c.Datastorer.FindTags(tags)
+	}
+
+	if c.decode(tagsCacheKey, tags) {
+		return nil
+	}
+
+	if err := c.Datastorer.FindTags(tags); err != nil {
+		return err
+	}
+	c.encode(tagsCacheKey, *tags)
+	return nil
+}
+
+func (c *CachedStore) CreateArticle(article *Article) error {
+	err := c.Datastorer.CreateArticle(article)
+	if err == nil {
+		c.invalidate(tagsCacheKey)
+	}
+	return err
+}
+
+func (c *CachedStore) SaveArticle(article *Article) error {
+	err := c.Datastorer.SaveArticle(article)
+	if err == nil {
+		c.invalidate(articleCacheKey(article.ID), tagsCacheKey)
+	}
+	return err
+}
+
+func (c *CachedStore) DeleteArticle(article *Article) error {
+	err := c.Datastorer.DeleteArticle(article)
+	if err == nil {
+		c.invalidate(articleCacheKey(article.ID), tagsCacheKey)
+	}
+	return err
+}
+
+func (c *CachedStore) RestoreArticle(article *Article) error {
+	err := c.Datastorer.RestoreArticle(article)
+	if err == nil {
+		c.invalidate(articleCacheKey(article.ID), tagsCacheKey)
+	}
+	return err
+}
+
+func (c *CachedStore) PurgeArticles(deletedBefore time.Time) (int, error) {
+	n, err := c.Datastorer.PurgeArticles(deletedBefore)
+	if n > 0 {
+		c.invalidate(tagsCacheKey)
+	}
+	return n, err
+}
+
+func (c *CachedStore) FavoriteArticle(userID int, articleID int) error {
+	err := c.Datastorer.FavoriteArticle(userID, articleID)
+	if err == nil {
+		c.invalidate(articleCacheKey(articleID))
+	}
+	return err
+}
+
+func (c *CachedStore) UnfavoriteArticle(userID int, articleID int) error {
+	err := c.Datastorer.UnfavoriteArticle(userID, articleID)
+	if err == nil {
+		c.invalidate(articleCacheKey(articleID))
+	}
+	return err
+}
+
+// MergeTags also invalidates the articles tagged from, their tags change
+func (c *CachedStore) MergeTags(from string, into string) (*Tag, error) {
+	articles, err := c.Datastorer.GetAllArticlesWithTag(NormalizeTagName(from))
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := c.Datastorer.MergeTags(from, into)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{tagsCacheKey}
+	for _, a := range articles {
+		keys = append(keys, articleCacheKey(a.ID))
+	}
+	c.invalidate(keys...)
+	return tag, nil
+}
+
+// WithContext returns the store with the decorated store running its
+// queries for ctx
+func (c *CachedStore) WithContext(ctx context.Context) Datastorer {
+	return &CachedStore{Datastorer: c.Datastorer.WithContext(ctx), Cache: c.Cache, TTL: c.TTL, OnError: c.OnError, pending: c.pending}
+}
+
+// WithTx runs fn in a transaction of the decorated store. The entries
+// invalidated by fn are deleted once the transaction ends, so concurrent
+// reads can't cache the data it is replacing.
+func (c *CachedStore) WithTx(fn func(Datastorer) error) error {
+	pending := c.pending
+	if pending == nil {
+		pending = new([]string)
+	}
+
+	err := c.Datastorer.WithTx(func(tx Datastorer) error {
+		return fn(&CachedStore{Datastorer: tx, Cache: c.Cache, TTL: c.TTL, OnError: c.OnError, pending: pending})
+	})
+
+	// Nested transactions leave it to the outermost one
+	if c.pending == nil && len(*pending) > 0 {
+		c.invalidate(*pending...)
+	}
+	return err
+}
+
+// invalidate deletes the keys, or defers it to the end of the transaction
+func (c *CachedStore) invalidate(keys ...string) {
+	if c.pending != nil {
+		*c.pending = append(*c.pending, keys...)
+		return
+	}
+	if err := c.Cache.Delete(keys...); err != nil {
+		c.report(err)
+	}
+}
+
+func (c *CachedStore) get(key string) ([]byte, bool) {
+	value, err := c.Cache.Get(key)
+	if err != nil {
+		if err != cache.ErrMiss {
+			c.report(err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *CachedStore) set(key string, value []byte) {
+	if err := c.Cache.Set(key, value, c.TTL); err != nil {
+		c.report(err)
+	}
+}
+
+// decode reads the gob encoded entry into v
+func (c *CachedStore) decode(key string, v interface{}) bool {
+	value, ok := c.get(key)
+	if !ok {
+		return false
+	}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(v); err != nil {
+		c.report(err)
+		return false
+	}
+	return true
+}
+
+// encode caches the gob encoding of v
+func (c *CachedStore) encode(key string, v interface{}) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		c.report(err)
+		return
+	}
+	c.set(key, buf.Bytes())
+}
+
+func (c *CachedStore) report(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/JackyChiu/realworld-starter-kit/cache"
+)
+
+func TestCachedStore_Datastorer(t *testing.T) {
+	runDatastorerTests(t, func(t *testing.T) Datastorer {
+		return NewCachedStore(NewMemoryStore(), cache.NewLRU(100, 0))
+	})
+}
+
+// countingStore counts the cached reads reaching the store
+type countingStore struct {
+	Datastorer
+	articleReads int
+	tagReads     int
+}
+
+func (s *countingStore) GetArticle(slug string) (*Article, error) {
+	s.articleReads++
+	return s.Datastorer.GetArticle(slug)
+}
+
+func (s *countingStore) FindTags(tags *[]Tag) error {
+	s.tagReads++
+	return s.Datastorer.FindTags(tags)
+}
+
+func TestCachedStore_Invalidation(t *testing.T) {
+	m := NewMemoryStore()
+	if err := SeedStore(m); err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingStore{Datastorer: m}
+	s := NewCachedStore(counting, cache.NewLRU(100, 0))
+
+	s.GetArticle("title-1")
+	a, err := s.GetArticle("title-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counting.articleReads != 1 {
+		t.Errorf("should read the article once: got %v want %v", counting.articleReads, 1)
+	}
+	if a.User.Username != "user1" || a.User.Password != "" || len(a.Tags) != 3 {
+		t.Errorf("should cache the author and tags without password: got %+v %v", a.User, len(a.Tags))
+	}
+
+	u, _ := s.FindUserByUsername("user2")
+	s.FavoriteArticle(u.ID, a.ID)
+	if a, _ = s.GetArticle("title-1"); a.FavoritesCount != 2 {
+		t.Errorf("should invalidate a favorited article: got %v want %v", a.FavoritesCount, 2)
+	}
+
+	err = s.WithTx(func(tx Datastorer) error {
+		a.Title = "Renamed"
+		if err := tx.SaveArticle(a); err != nil {
+			return err
+		}
+		if _, err := tx.GetArticle("renamed"); err != nil {
+			t.Errorf("should see the writes of the transaction: got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetArticle("title-1"); err == nil {
+		t.Errorf("should not find a renamed article under its old slug")
+	}
+	if a, _ = s.GetArticle("renamed"); a.Title != "Renamed" {
+		t.Errorf("should invalidate a saved article: got %v want %v", a.Title, "Renamed")
+	}
+
+	var tags []Tag
+	s.FindTags(&tags)
+	s.FindTags(&tags)
+	if counting.tagReads != 1 {
+		t.Errorf("should read the tags once: got %v want %v", counting.tagReads, 1)
+	}
+
+	b := NewArticle("New", "Description", "Body", u)
+	b.Tags = []Tag{{Name: "new"}}
+	s.CreateArticle(b)
+	if s.FindTags(&tags); len(tags) != 16 {
+		t.Errorf("should invalidate the tags: got %v want %v", len(tags), 16)
+	}
+
+	if err := s.DeleteArticle(a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetArticle("renamed"); err == nil {
+		t.Errorf("should not find a deleted article")
+	}
+}
+
+func TestCachedStore_KeepsPasswords(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+	s := NewCachedStore(db, cache.NewLRU(100, 0))
+
+	before, _ := db.FindUserByUsername("user1")
+
+	// The second read is a cache hit, its author has no password
+	s.GetArticle("title-1")
+	a, err := s.GetArticle("title-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Title = "Renamed"
+	if err := s.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewArticle("New", "Description", "Body", &a.User)
+	if err := s.CreateArticle(b); err != nil {
+		t.Fatal(err)
+	}
+
+	after, _ := db.FindUserByUsername("user1")
+	if after.Password == "" || after.Password != before.Password {
+		t.Errorf("should not save the author of a cached article: got %q want %q", after.Password, before.Password)
+	}
+}
@@ -0,0 +1,1257 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// datastorerTests is the conformance suite every Datastorer must pass.
+// Each test gets a fresh store filled by SeedStore.
+var datastorerTests = []struct {
+	name string
+	test func(*testing.T, Datastorer)
+}{
+	{"CreateUser", testCreateUser},
+	{"FindUser", testFindUser},
+	{"UpdatePassword", testUpdatePassword},
+	{"GetArticle", testGetArticle},
+	{"GetArticles", testGetArticles},
+	{"GetArticlesPagination", testGetArticlesPagination},
+	{"CreateArticle", testCreateArticle},
+	{"SaveArticle", testSaveArticle},
+	{"DeleteArticle", testDeleteArticle},
+	{"RestoreArticle", testRestoreArticle},
+	{"PurgeArticles", testPurgeArticles},
+	{"Revisions", testRevisions},
+	{"ArticleVersions", testArticleVersions},
+	{"ArticleStatus", testArticleStatus},
+	{"SearchArticles", testSearchArticles},
+	{"TagAliases", testTagAliases},
+	{"MergeTags", testMergeTags},
+	{"TaggingsCount", testTaggingsCount},
+	{"RelatedArticles", testRelatedArticles},
+	{"SortArticles", testSortArticles},
+	{"FavoriteArticle", testFavoriteArticle},
+	{"FindTags", testFindTags},
+	{"APITokens", testAPITokens},
+	{"FavoritesCount", testFavoritesCount},
+	{"BatchLookups", testBatchLookups},
+	{"WithTx", testWithTx},
+	{"ConcurrentFavorites", testConcurrentFavorites},
+	{"ConcurrentTags", testConcurrentTags},
+}
+
+func runDatastorerTests(t *testing.T, newStore func(*testing.T) Datastorer) {
+	for _, tt := range datastorerTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore(t)
+			if err := SeedStore(s); err != nil {
+				t.Fatal(err)
+			}
+			tt.test(t, s)
+		})
+	}
+}
+
+func TestDB_Datastorer(t *testing.T) {
+	runDatastorerTests(t, func(t *testing.T) Datastorer {
+		db := newTestDB(t)
+		if err := db.InitSchema(); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestMemoryStore_Datastorer(t *testing.T) {
+	runDatastorerTests(t, func(t *testing.T) Datastorer {
+		return NewMemoryStore()
+	})
+}
+
+func testCreateUser(t *testing.T, s Datastorer) {
+	u := &User{Username: "user3", Email: "user3@example.com"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	if u.ID == 0 {
+		t.Errorf("should assign an id to the user")
+	}
+
+	if err := s.CreateUser(&User{Username: "other", Email: "user3@example.com"}); err == nil {
+		t.Errorf("should not create a user with a taken email")
+	}
+
+	if err := s.CreateUser(&User{Username: "user3", Email: "other@example.com"}); err == nil {
+		t.Errorf("should not create a user with a taken username")
+	}
+}
+
+func testFindUser(t *testing.T, s Datastorer) {
+	u, err := s.FindUserByEmail("user2@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Username != "user2" {
+		t.Errorf("should find the user by email: got %v want %v", u.Username, "user2")
+	}
+
+	if _, err := s.FindUserByEmail("nobody@example.com"); err == nil {
+		t.Errorf("should not find an unknown email")
+	}
+
+	u, err = s.FindUserByUsername("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Email != "user1@example.com" {
+		t.Errorf("should find the user by username: got %v want %v", u.Email, "user1@example.com")
+	}
+
+	if _, err := s.FindUserByUsername("nobody"); err == nil {
+		t.Errorf("should not find an unknown username")
+	}
+}
+
+func testUpdatePassword(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+	u.Password = "new hash"
+
+	if err := s.UpdatePassword(u); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ = s.FindUserByUsername("user1")
+	if u.Password != "new hash" {
+		t.Errorf("should update the password: got %v want %v", u.Password, "new hash")
+	}
+}
+
+func testGetArticle(t *testing.T, s Datastorer) {
+	a, err := s.GetArticle("title-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Title != "Title 3" {
+		t.Errorf("should return the correct article title: got %v want %v", a.Title, "Title 3")
+	}
+
+	if len(a.Tags) != 3 {
+		t.Errorf("should preload the article tags: got %v want %v", len(a.Tags), 3)
+	}
+
+	if a.User.Username != "user1" {
+		t.Errorf("should preload the article author: got %v want %v", a.User.Username, "user1")
+	}
+
+	if _, err := s.GetArticle("unknown"); err == nil {
+		t.Errorf("should not find an unknown slug")
+	}
+}
+
+func testGetArticles(t *testing.T, s Datastorer) {
+	tests := []struct {
+		query  ArticleQuery
+		titles []string
+	}{
+		{ArticleQuery{}, []string{"Title 5", "Title 4", "Title 3", "Title 2", "Title 1"}},
+		{ArticleQuery{Tags: []string{"tag4"}}, []string{"Title 2"}},
+		{ArticleQuery{Author: "user2"}, []string{"Title 4", "Title 2"}},
+		{ArticleQuery{FavoritedBy: "user1"}, []string{"Title 5", "Title 3", "Title 1"}},
+		{ArticleQuery{Author: "user1", Tags: []string{"tag1"}}, []string{"Title 1"}},
+		{ArticleQuery{Author: "user2", Tags: []string{"tag1"}}, nil},
+		{ArticleQuery{Tags: []string{"unknown"}}, nil},
+		{ArticleQuery{Tags: []string{"tag1", "tag4"}}, []string{"Title 2", "Title 1"}},
+		{ArticleQuery{Tags: []string{"tag1", "tag4"}, AllTags: true}, nil},
+		{ArticleQuery{Tags: []string{"tag1", "tag2"}, AllTags: true}, []string{"Title 1"}},
+		{ArticleQuery{ExcludedTags: []string{"tag1", "tag4"}}, []string{"Title 5", "Title 4", "Title 3"}},
+		{ArticleQuery{Tags: []string{"tag1"}, ExcludedTags: []string{"tag2"}}, nil},
+		{ArticleQuery{Since: time.Now().Add(time.Hour)}, nil},
+		{ArticleQuery{Until: time.Now().Add(-time.Hour)}, nil},
+		{ArticleQuery{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour), Author: "user2"}, []string{"Title 4", "Title 2"}},
+	}
+
+	for _, tt := range tests {
+		articles, err := s.GetArticles(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := titles(articles); fmt.Sprint(got) != fmt.Sprint(tt.titles) {
+			t.Errorf("%+v should return the matching articles: got %v want %v", tt.query, got, tt.titles)
+		}
+	}
+}
+
+func testGetArticlesPagination(t *testing.T, s Datastorer) {
+	articles, err := s.GetArticles(ArticleQuery{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Title 4", "Title 3"}
+	if got := titles(articles); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("should return the requested page: got %v want %v", got, want)
+	}
+
+	articles, err = s.GetArticles(ArticleQuery{Offset: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(articles) != 0 {
+		t.Errorf("should return no article past the end: got %v", titles(articles))
+	}
+}
+
+func testCreateArticle(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user2")
+	existing, _ := s.FindTagOrInit("tag1")
+	created, _ := s.FindTagOrInit("brand new")
+
+	a := NewArticle("A New Article", "Description", "Body", u)
+	a.Tags = []Tag{existing, created}
+
+	if err := s.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Slug != "a-new-article" {
+		t.Errorf("should slugify the title: got %v want %v", a.Slug, "a-new-article")
+	}
+
+	a, err := s.GetArticle("a-new-article")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.User.Username != "user2" {
+		t.Errorf("should save the author: got %v want %v", a.User.Username, "user2")
+	}
+
+	if len(a.Tags) != 2 {
+		t.Errorf("should save the tags: got %v want %v", len(a.Tags), 2)
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{Tags: []string{"tag1"}})
+	if len(articles) != 2 {
+		t.Errorf("should reuse the existing tag: got %v want %v", len(articles), 2)
+	}
+}
+
+func testSaveArticle(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-1")
+	a.Title = "Updated Title"
+	a.Body = "Updated Body"
+
+	if err := s.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := s.GetArticle("updated-title")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Body != "Updated Body" {
+		t.Errorf("should save the body: got %v want %v", a.Body, "Updated Body")
+	}
+
+	if len(a.Tags) != 3 {
+		t.Errorf("should keep the tags: got %v want %v", len(a.Tags), 3)
+	}
+
+	if _, err := s.GetArticle("title-1"); err == nil {
+		t.Errorf("should not find the article under its old slug")
+	}
+}
+
+func testDeleteArticle(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-2")
+
+	if err := s.DeleteArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetArticle("title-2"); err == nil {
+		t.Errorf("should not find a deleted article")
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{})
+	if len(articles) != 4 {
+		t.Errorf("should not list a deleted article: got %v want %v", len(articles), 4)
+	}
+}
+
+func testRestoreArticle(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-2")
+	s.DeleteArticle(a)
+
+	deleted, err := s.GetDeletedArticle("title-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted.DeletedAt == nil || deleted.User.Username != "user2" {
+		t.Errorf("should return the deleted article with its author: got %+v", deleted)
+	}
+
+	if err := s.RestoreArticle(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetArticle("title-2"); err != nil {
+		t.Errorf("should find a restored article: %v", err)
+	}
+
+	if _, err := s.GetDeletedArticle("title-2"); err == nil {
+		t.Errorf("should not find a restored article among the deleted ones")
+	}
+
+	// Restoring must not shadow an article created with the same slug
+	s.DeleteArticle(a)
+	u, _ := s.FindUserByUsername("user1")
+	s.CreateArticle(NewArticle("Title 2", "Description", "Body", u))
+
+	deleted, _ = s.GetDeletedArticle("title-2")
+	if err := s.RestoreArticle(deleted); err == nil {
+		t.Errorf("should not restore an article whose slug is taken")
+	}
+}
+
+func testPurgeArticles(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-2")
+	s.DeleteArticle(a)
+
+	if n, err := s.PurgeArticles(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("should keep articles deleted after the cutoff: got %v, %v", n, err)
+	}
+
+	n, err := s.PurgeArticles(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("should purge the deleted article: got %v want %v", n, 1)
+	}
+
+	if _, err := s.GetDeletedArticle("title-2"); err == nil {
+		t.Errorf("should not find a purged article")
+	}
+
+	favorited, _ := s.FavoritedArticleIDs(a.UserID, []int{a.ID})
+	if favorited[a.ID] {
+		t.Errorf("should delete the favorites of a purged article")
+	}
+
+	var tags []Tag
+	s.FindTags(&tags)
+	if len(tags) != 15 {
+		t.Errorf("should keep the tags: got %v want %v", len(tags), 15)
+	}
+}
+
+func testRevisions(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-1")
+
+	a.Body = "Second body"
+	if err := s.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Title = "Third Title"
+	if err := s.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := s.GetRevisions(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revisions) != 3 {
+		t.Fatalf("should record a revision on create and every save: got %v want %v", len(revisions), 3)
+	}
+
+	if a, _ := s.GetArticle(a.Slug); a.Revision != 3 {
+		t.Errorf("should keep the latest revision number: got %v want %v", a.Revision, 3)
+	}
+
+	for i, r := range revisions {
+		if r.Number != i+1 {
+			t.Errorf("should number the revisions in order: got %v want %v", r.Number, i+1)
+		}
+		if r.User.Username != "user1" {
+			t.Errorf("should preload the revision author: got %v want %v", r.User.Username, "user1")
+		}
+	}
+
+	r, err := s.GetRevision(a.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Title != "Title 1" || r.Body != "Second body" {
+		t.Errorf("should return the content of the revision: got %+v", r)
+	}
+
+	if _, err := s.GetRevision(a.ID, 4); err == nil {
+		t.Errorf("should not find an unknown revision")
+	}
+}
+
+func testArticleVersions(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-1")
+	stale, _ := s.GetArticle("title-1")
+
+	if a.Version != 1 {
+		t.Errorf("should create articles at version 1: got %v want %v", a.Version, 1)
+	}
+
+	a.Body = "Updated Body"
+	if err := s.SaveArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Version != 2 {
+		t.Errorf("should bump the version: got %v want %v", a.Version, 2)
+	}
+
+	stale.Body = "Stale Body"
+	if err := s.SaveArticle(stale); err != ErrVersionConflict {
+		t.Errorf("should not save a stale article: got %v want %v", err, ErrVersionConflict)
+	}
+
+	if err := s.DeleteArticle(stale); err != ErrVersionConflict {
+		t.Errorf("should not delete a stale article: got %v want %v", err, ErrVersionConflict)
+	}
+
+	found, _ := s.GetArticle("title-1")
+	if found.Body != "Updated Body" || found.Version != 2 {
+		t.Errorf("should keep the first save: got %v %v", found.Body, found.Version)
+	}
+
+	if err := s.SaveArticle(a); err != nil {
+		t.Errorf("should save the latest version again: got %v", err)
+	}
+
+	if err := s.DeleteArticle(a); err != nil {
+		t.Errorf("should delete the latest version: got %v", err)
+	}
+}
+
+func testArticleStatus(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+
+	draft := NewArticle("Draft", "Description", "Body", u)
+	draft.Status = StatusDraft
+	s.CreateArticle(draft)
+
+	publishAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	scheduled := NewArticle("Scheduled", "Description", "Body", u)
+	scheduled.Status = StatusScheduled
+	scheduled.PublishAt = &publishAt
+	s.CreateArticle(scheduled)
+
+	unlisted := NewArticle("Unlisted", "Description", "Body", u)
+	unlisted.Status = StatusUnlisted
+	s.CreateArticle(unlisted)
+
+	if draft.PublishedAt != nil || unlisted.PublishedAt == nil {
+		t.Errorf("should only set publishedAt once published")
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{})
+	if len(articles) != 5 {
+		t.Errorf("should only list published articles: got %v", titles(articles))
+	}
+
+	articles, _ = s.GetArticles(ArticleQuery{ViewerID: u.ID, Author: "user1"})
+	if len(articles) != 6 {
+		t.Errorf("should list the unpublished articles of the viewer: got %v", titles(articles))
+	}
+
+	if n, _ := s.PublishScheduledArticles(time.Now()); n != 0 {
+		t.Errorf("should not publish before publishAt: got %v", n)
+	}
+
+	n, err := s.PublishScheduledArticles(publishAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("should publish the scheduled article: got %v want %v", n, 1)
+	}
+
+	a, _ := s.GetArticle("scheduled")
+	if a.Status != StatusPublished || a.PublishedAt == nil || !a.PublishedAt.Equal(publishAt) {
+		t.Errorf("should be published at publishAt: got %v %v", a.Status, a.PublishedAt)
+	}
+}
+
+func testSearchArticles(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+
+	a := NewArticle("Gophers in space", "Description", "A body about <b>rockets</b> and gophers", u)
+	a.Tags = []Tag{{Name: "golang"}}
+	if err := s.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewArticle("Rockets", "Description", "Nothing to see", u)
+	b.Status = StatusDraft
+	if err := s.CreateArticle(b); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		viewerID int
+		want     []string
+	}{
+		{"gopher", 0, []string{"gophers-in-space"}},
+		{"GOLANG", 0, []string{"gophers-in-space"}},
+		{"rockets", 0, []string{"gophers-in-space"}},
+		{"rockets", u.ID, []string{"rockets", "gophers-in-space"}},
+		{"rockets gophers", u.ID, []string{"gophers-in-space"}},
+		{"title", 0, []string{"title-5", "title-4", "title-3", "title-2", "title-1"}},
+		{"unknown", 0, nil},
+		{"  ", 0, nil},
+	}
+
+	for _, tt := range tests {
+		results, total, err := s.SearchArticles(SearchQuery{Query: tt.query, ViewerID: tt.viewerID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var slugs []string
+		for _, r := range results {
+			slugs = append(slugs, r.Article.Slug)
+		}
+
+		if !reflect.DeepEqual(slugs, tt.want) || total != len(tt.want) {
+			t.Errorf("%q should match %v: got %v (%v)", tt.query, tt.want, slugs, total)
+		}
+	}
+
+	results, _, _ := s.SearchArticles(SearchQuery{Query: "rockets"})
+	if want := "A body about &lt;b&gt;<mark>rockets</mark>&lt;/b&gt; and gophers"; len(results) != 1 || results[0].Snippet != want {
+		t.Errorf("should return an escaped snippet with the matches highlighted: got %+v want %q", results, want)
+	}
+
+	results, total, _ := s.SearchArticles(SearchQuery{Query: "title", Limit: 2, Offset: 1})
+	if len(results) != 2 || total != 5 || results[0].Article.Slug != "title-4" {
+		t.Errorf("should paginate the results: got %v results out of %v", len(results), total)
+	}
+
+	s.DeleteArticle(a)
+	if results, _, _ := s.SearchArticles(SearchQuery{Query: "gopher"}); len(results) != 0 {
+		t.Errorf("should not match deleted articles: got %v", len(results))
+	}
+}
+
+func testFavoriteArticle(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-2")
+	u, _ := s.FindUserByUsername("user1")
+
+	if err := s.FavoriteArticle(u.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.IsFavorited(u.ID, a.ID) {
+		t.Errorf("article should be favorited")
+	}
+
+	if err := s.FavoriteArticle(u.ID, a.ID); err == nil {
+		t.Errorf("should not favorite an article twice")
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{FavoritedBy: "user1"})
+	if len(articles) != 4 {
+		t.Errorf("should return the articles favorited by user1: got %v want %v", len(articles), 4)
+	}
+
+	if err := s.UnfavoriteArticle(u.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.IsFavorited(u.ID, a.ID) {
+		t.Errorf("article should not be favorited")
+	}
+
+	if err := s.UnfavoriteArticle(u.ID, a.ID); err == nil {
+		t.Errorf("should not unfavorite an article twice")
+	}
+}
+
+func testFindTags(t *testing.T, s Datastorer) {
+	tag, err := s.FindTagOrInit("tag1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.ID == 0 {
+		t.Errorf("should find the existing tag")
+	}
+
+	found := Tag{Name: "tag1"}
+	if err := s.FindTag(&found); err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != tag.ID {
+		t.Errorf("should find the tag by name: got %v want %v", found.ID, tag.ID)
+	}
+
+	tag, err = s.FindTagOrInit("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.ID != 0 || tag.Name != "new" {
+		t.Errorf("should init a new tag: got %v", tag)
+	}
+
+	var tags []Tag
+	if err := s.FindTags(&tags); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tags) != 15 {
+		t.Errorf("should return every tag: got %v want %v", len(tags), 15)
+	}
+}
+
+func testTagAliases(t *testing.T, s Datastorer) {
+	tag, err := s.FindOrCreateTag("  Go   Lang ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.Name != "go lang" {
+		t.Errorf("should normalize the tag name: got %q want %q", tag.Name, "go lang")
+	}
+
+	if err := s.CreateTagAlias("Golang", "go lang"); err != nil {
+		t.Fatal(err)
+	}
+
+	aliased, err := s.FindOrCreateTag("GOLANG")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aliased.ID != tag.ID {
+		t.Errorf("should resolve the alias to its tag: got %v want %v", aliased.Name, tag.Name)
+	}
+
+	if err := s.CreateTagAlias("golang", "go lang"); err == nil {
+		t.Errorf("should not create the same alias twice")
+	}
+
+	if err := s.CreateTagAlias("tag1", "go lang"); err == nil {
+		t.Errorf("should not alias the name of an existing tag")
+	}
+
+	if err := s.CreateTagAlias("rust", "unknown"); err == nil {
+		t.Errorf("should not alias an unknown tag")
+	}
+}
+
+func testMergeTags(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+
+	both := NewArticle("Both", "Description", "Body", u)
+	for _, name := range []string{"tag0", "tag3"} {
+		tag, _ := s.FindOrCreateTag(name)
+		both.Tags = append(both.Tags, tag)
+	}
+	if err := s.CreateArticle(both); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.MergeTags("tag0", "TAG0"); err == nil {
+		t.Errorf("should not merge a tag into itself")
+	}
+
+	if _, err := s.MergeTags("unknown", "tag3"); err == nil {
+		t.Errorf("should not merge an unknown tag")
+	}
+
+	tag, err := s.MergeTags("tag0", "tag3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.Name != "tag3" || tag.TaggingsCount != 3 {
+		t.Errorf("should recompute the merged tag count: got %v %v want %v %v", tag.Name, tag.TaggingsCount, "tag3", 3)
+	}
+
+	a, _ := s.GetArticle("both")
+	if len(a.Tags) != 1 || a.Tags[0].Name != "tag3" {
+		t.Errorf("should keep a single tagging for articles tagged with both tags: got %v", a.Tags)
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{Tags: []string{"Tag0"}})
+	if len(articles) != 3 {
+		t.Errorf("should resolve the merged tag as an alias: got %v", titles(articles))
+	}
+
+	if found, _ := s.FindOrCreateTag("tag0"); found.ID != tag.ID {
+		t.Errorf("should not recreate the merged tag: got %v", found)
+	}
+
+	var tags []Tag
+	s.FindTags(&tags)
+	if len(tags) != 14 {
+		t.Errorf("should delete the merged tag: got %v want %v", len(tags), 14)
+	}
+}
+
+func testTaggingsCount(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+
+	count := func() uint {
+		tag := Tag{Name: "counted"}
+		if err := s.FindTag(&tag); err != nil {
+			t.Fatal(err)
+		}
+		return tag.TaggingsCount
+	}
+
+	tag, _ := s.FindOrCreateTag("counted")
+	a := NewArticle("Counted", "Description", "Body", u)
+	a.Tags = []Tag{tag}
+	if err := s.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("should count a created article: got %v want %v", n, 1)
+	}
+
+	b, _ := s.GetArticle("title-1")
+	b.Tags = append(b.Tags, tag)
+	if err := s.SaveArticle(b); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("should count an updated article: got %v want %v", n, 2)
+	}
+
+	if err := s.DeleteArticle(a); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("should not count a deleted article: got %v want %v", n, 1)
+	}
+
+	if err := s.RestoreArticle(a); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("should count a restored article: got %v want %v", n, 2)
+	}
+
+	s.DeleteArticle(a)
+	if _, err := s.PurgeArticles(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("should not count a purged article: got %v want %v", n, 1)
+	}
+}
+
+func testRelatedArticles(t *testing.T, s Datastorer) {
+	user1, _ := s.FindUserByUsername("user1")
+	user2, _ := s.FindUserByUsername("user2")
+
+	a, _ := s.GetArticle("title-1")
+
+	shared := NewArticle("Shared", "Description", "Body", user2)
+	shared.Tags = a.Tags[:2]
+	if err := s.CreateArticle(shared); err != nil {
+		t.Fatal(err)
+	}
+
+	draft := NewArticle("Draft", "Description", "Body", user2)
+	draft.Tags = a.Tags
+	draft.Status = StatusDraft
+	if err := s.CreateArticle(draft); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		viewerID int
+		limit    int
+		want     []string
+	}{
+		{0, 0, []string{"Shared", "Title 5", "Title 3"}},
+		{0, 1, []string{"Shared"}},
+		{user1.ID, 0, []string{"Shared"}},
+		{user2.ID, 0, []string{"Title 5", "Title 3"}},
+	}
+
+	for _, tt := range tests {
+		articles, err := s.GetRelatedArticles(a, ArticleQuery{ViewerID: tt.viewerID, Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := titles(articles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("viewer %v should get %v: got %v", tt.viewerID, tt.want, got)
+		}
+	}
+}
+
+func testSortArticles(t *testing.T, s Datastorer) {
+	user2, _ := s.FindUserByUsername("user2")
+	a, _ := s.GetArticle("title-3")
+	if err := s.FavoriteArticle(user2.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query ArticleQuery
+		want  []string
+	}{
+		{ArticleQuery{}, []string{"Title 5", "Title 4", "Title 3", "Title 2", "Title 1"}},
+		{ArticleQuery{Sort: SortNewest}, []string{"Title 5", "Title 4", "Title 3", "Title 2", "Title 1"}},
+		{ArticleQuery{Sort: SortOldest}, []string{"Title 1", "Title 2", "Title 3", "Title 4", "Title 5"}},
+		{ArticleQuery{Sort: SortMostFavorited}, []string{"Title 3", "Title 5", "Title 4", "Title 2", "Title 1"}},
+		{ArticleQuery{Sort: SortTrending}, []string{"Title 3", "Title 5", "Title 4", "Title 2", "Title 1"}},
+		{ArticleQuery{Sort: SortOldest, Limit: 2, Offset: 1}, []string{"Title 2", "Title 3"}},
+		{ArticleQuery{Sort: SortMostFavorited, Author: "user2"}, []string{"Title 4", "Title 2"}},
+		// Every favorite is older than a nanosecond window, trending falls
+		// back to the newest first
+		{ArticleQuery{Sort: SortTrending, TrendingWindow: time.Nanosecond}, []string{"Title 5", "Title 4", "Title 3", "Title 2", "Title 1"}},
+	}
+
+	for _, tt := range tests {
+		articles, err := s.GetArticles(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := titles(articles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v should return %v: got %v", tt.query, tt.want, got)
+		}
+	}
+}
+
+func testAPITokens(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+
+	// A stale copy of the user, like one read before a password rehash
+	stale := *u
+	stale.Password = "stale"
+	token, secret, err := NewAPIToken(&stale, "script", []string{"read:articles"}, "test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CreateAPIToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	if after, _ := s.FindUserByUsername("user1"); after.Password != u.Password {
+		t.Errorf("should not save the token owner: got %q want %q", after.Password, u.Password)
+	}
+
+	found, err := s.FindAPITokenByHash(HashAPIToken(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.User.Username != "user1" {
+		t.Errorf("should preload the token owner: got %v want %v", found.User.Username, "user1")
+	}
+
+	if err := s.TouchAPIToken(found); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, _ := s.FindAPITokens(u.ID)
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Errorf("should list the used token: got %v", tokens)
+	}
+
+	other, _ := s.FindUserByUsername("user2")
+	if err := s.RevokeAPIToken(other.ID, token.ID); err == nil {
+		t.Errorf("should not revoke the token of another user")
+	}
+
+	if err := s.RevokeAPIToken(u.ID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindAPITokenByHash(HashAPIToken(secret)); err == nil {
+		t.Errorf("should not find a revoked token")
+	}
+}
+
+func testFavoritesCount(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-2")
+	u, _ := s.FindUserByUsername("user1")
+
+	if a.FavoritesCount != 1 {
+		t.Errorf("should count the seeded favorite: got %v want %v", a.FavoritesCount, 1)
+	}
+
+	s.FavoriteArticle(u.ID, a.ID)
+	s.FavoriteArticle(u.ID, a.ID)
+
+	a, _ = s.GetArticle("title-2")
+	if a.FavoritesCount != 2 {
+		t.Errorf("should count a favorite once: got %v want %v", a.FavoritesCount, 2)
+	}
+
+	// A stale copy must not overwrite the count
+	stale := *a
+	stale.FavoritesCount = 0
+	stale.Body = "Edited"
+	if err := s.SaveArticle(&stale); err != nil {
+		t.Fatal(err)
+	}
+
+	s.UnfavoriteArticle(u.ID, a.ID)
+	s.UnfavoriteArticle(u.ID, a.ID)
+
+	a, _ = s.GetArticle("title-2")
+	if a.FavoritesCount != 1 {
+		t.Errorf("should uncount a favorite once: got %v want %v", a.FavoritesCount, 1)
+	}
+
+	if err := s.ReconcileFavoritesCounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ = s.GetArticle("title-2")
+	if a.FavoritesCount != 1 {
+		t.Errorf("should keep a correct count: got %v want %v", a.FavoritesCount, 1)
+	}
+}
+
+func testBatchLookups(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+	articles, _ := s.GetArticles(ArticleQuery{})
+
+	var ids []int
+	for _, a := range articles {
+		ids = append(ids, a.ID)
+	}
+
+	favorited, err := s.FavoritedArticleIDs(u.ID, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range articles {
+		if favorited[a.ID] != s.IsFavorited(u.ID, a.ID) {
+			t.Errorf("%v should match IsFavorited: got %v", a.Slug, favorited[a.ID])
+		}
+	}
+
+	if len(favorited) != 3 {
+		t.Errorf("should return the favorited articles: got %v want %v", len(favorited), 3)
+	}
+
+	favorited, err = s.FavoritedArticleIDs(0, ids)
+	if err != nil || len(favorited) != 0 {
+		t.Errorf("anonymous users should have no favorites: got %v, %v", favorited, err)
+	}
+}
+
+// TestDB_ArticleListQueries makes sure rendering a list of articles costs
+// the same number of queries whatever the number of articles
+func TestDB_ArticleListQueries(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+
+	// gorm also runs the query callbacks on every row of many2many
+	// preloads, only the calls that ran a statement are counted
+	queries := 0
+	count := func(scope *gorm.Scope) {
+		if scope.SQL != "" {
+			queries++
+		}
+	}
+	db.Callback().Query().After("gorm:query").Register("test:count_queries", count)
+	db.Callback().RowQuery().After("gorm:row_query").Register("test:count_row_queries", count)
+
+	listQueries := func() int {
+		queries = 0
+		articles, _ := db.GetArticles(ArticleQuery{})
+		var articleIDs, authorIDs []int
+		for _, a := range articles {
+			articleIDs = append(articleIDs, a.ID)
+			authorIDs = append(authorIDs, a.UserID)
+		}
+		db.FavoritedArticleIDs(1, articleIDs)
+		db.FollowedUserIDs(1, authorIDs)
+		return queries
+	}
+
+	before := listQueries()
+
+	u, _ := db.FindUserByUsername("user1")
+	for i := 0; i < 10; i++ {
+		db.CreateArticle(NewArticle(fmt.Sprintf("More %d", i), "Description", "Body", u))
+	}
+
+	if after := listQueries(); after != before {
+		t.Errorf("should not run more queries for more articles: got %v want %v", after, before)
+	}
+
+	if before > 4 {
+		t.Errorf("should list articles in a bounded number of queries: got %v", before)
+	}
+}
+
+func TestDB_InstrumentQueries(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+
+	var mu sync.Mutex
+	observed := make(map[string]int)
+	db.InstrumentQueries(func(operation, table string, d time.Duration) {
+		mu.Lock()
+		observed[operation+" "+table]++
+		mu.Unlock()
+	})
+
+	u, _ := db.FindUserByUsername("user1")
+	a := NewArticle("Instrumented", "Description", "Body", u)
+	if err := db.CreateArticle(a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetArticle(a.Slug); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"query users", "create articles", "query articles"} {
+		if observed[key] == 0 {
+			t.Errorf("should observe %q: got %v", key, observed)
+		}
+	}
+
+	// The tags are preloaded in one statement whatever their number
+	observed = make(map[string]int)
+	if _, err := db.GetArticle("title-1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := observed["query tags"] + observed["row_query tags"]; n != 1 {
+		t.Errorf("should only observe the statements run: got %v want %v", n, 1)
+	}
+}
+
+func TestDB_TraceQueries(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	db.TraceQueries(tracer)
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	if _, err := db.WithContext(ctx).GetArticle("title-1"); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	var found bool
+	for _, span := range recorder.Ended() {
+		if span.Name() == "query tags" {
+			t.Errorf("should not trace the rows of the tags preload")
+		}
+		if span.Name() != "query articles" {
+			continue
+		}
+		found = true
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("should trace the query in the span of the context: got %v", span.Parent())
+		}
+	}
+	if !found {
+		t.Errorf("should trace the query of the article: got %v", recorder.Ended())
+	}
+}
+
+func TestDB_ReconcileFavoritesCounts(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+
+	if err := db.Exec("UPDATE articles SET favorites_count = 42").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ReconcileFavoritesCounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	articles, _ := db.GetArticles(ArticleQuery{})
+	for _, a := range articles {
+		if a.FavoritesCount != 1 {
+			t.Errorf("should recompute the count of %v: got %v want %v", a.Slug, a.FavoritesCount, 1)
+		}
+	}
+}
+
+func testWithTx(t *testing.T, s Datastorer) {
+	err := s.WithTx(func(tx Datastorer) error {
+		if _, err := tx.FindOrCreateTag("committed"); err != nil {
+			return err
+		}
+		// Nested calls join the running transaction
+		return tx.WithTx(func(tx Datastorer) error {
+			_, err := tx.FindOrCreateTag("nested")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollback := fmt.Errorf("rollback")
+	err = s.WithTx(func(tx Datastorer) error {
+		if _, err := tx.FindOrCreateTag("rolled back"); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Errorf("should return the error of the callback: got %v want %v", err, rollback)
+	}
+
+	for name, want := range map[string]bool{"committed": true, "nested": true, "rolled back": false} {
+		tag := Tag{Name: name}
+		if found := s.FindTag(&tag) == nil; found != want {
+			t.Errorf("tag %q should exist: got %v want %v", name, found, want)
+		}
+	}
+}
+
+func testConcurrentFavorites(t *testing.T, s Datastorer) {
+	a, _ := s.GetArticle("title-2")
+	u, _ := s.FindUserByUsername("user1")
+
+	errs := concurrently(10, func() error {
+		return s.FavoriteArticle(u.ID, a.ID)
+	})
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+
+	if succeeded != 1 {
+		t.Errorf("should favorite the article exactly once: got %v want %v", succeeded, 1)
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{FavoritedBy: "user1"})
+	if len(articles) != 4 {
+		t.Errorf("should not create duplicate favorites: got %v want %v", len(articles), 4)
+	}
+}
+
+func testConcurrentTags(t *testing.T, s Datastorer) {
+	u, _ := s.FindUserByUsername("user1")
+
+	i := 0
+	var mu sync.Mutex
+	errs := concurrently(10, func() error {
+		mu.Lock()
+		i++
+		a := NewArticle(fmt.Sprintf("Concurrent %d", i), "Description", "Body", u)
+		mu.Unlock()
+
+		return RetryOnConflict(3, func() error {
+			return s.WithTx(func(tx Datastorer) error {
+				a.ID = 0
+				tag, err := tx.FindOrCreateTag("shared")
+				if err != nil {
+					return err
+				}
+				a.Tags = []Tag{tag}
+				return tx.CreateArticle(a)
+			})
+		})
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tags []Tag
+	s.FindTags(&tags)
+
+	shared := 0
+	for _, tag := range tags {
+		if tag.Name == "shared" {
+			shared++
+		}
+	}
+
+	if shared != 1 {
+		t.Errorf("should not create duplicate tags: got %v want %v", shared, 1)
+	}
+
+	articles, _ := s.GetArticles(ArticleQuery{Tags: []string{"shared"}})
+	if len(articles) != 10 {
+		t.Errorf("should tag every article: got %v want %v", len(articles), 10)
+	}
+}
+
+// concurrently calls fn n times in parallel and returns the errors
+func concurrently(n int, fn func() error) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn()
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func titles(articles []Article) []string {
+	var titles []string
+	for _, a := range articles {
+		titles = append(titles, a.Title)
+	}
+	return titles
+}
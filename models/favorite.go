@@ -1,9 +1,12 @@
 package models
 
+import "time"
+
 type Favorite struct {
 	ID        int
 	User      User
-	UserID    int
+	UserID    int `gorm:"unique_index:idx_favorites_user_article"`
 	Article   Article
-	ArticleID int
+	ArticleID int `gorm:"unique_index:idx_favorites_user_article"`
+	CreatedAt time.Time
 }
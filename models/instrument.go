@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const queryStartKey = "instrument:query_start"
+
+// InstrumentQueries calls observe with the duration of every query run
+// through gorm, by operation (create, query, row_query, update and delete)
+// and table. Statements run with Exec skip the gorm callbacks and are not
+// observed.
+func (db *DB) InstrumentQueries(observe func(operation, table string, d time.Duration)) {
+	start := func(scope *gorm.Scope) {
+		if !skipsQuery(scope) {
+			scope.InstanceSet(queryStartKey, time.Now())
+		}
+	}
+	end := func(operation string) func(*gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			v, ok := scope.InstanceGet(queryStartKey)
+			if !ok {
+				return
+			}
+			observe(operation, queryTable(scope), time.Since(v.(time.Time)))
+		}
+	}
+
+	callbacks := db.Callback()
+	callbacks.Create().Before("gorm:create").Register("instrument:create_start", start)
+	callbacks.Create().After("gorm:create").Register("instrument:create_end", end("create"))
+	callbacks.Query().Before("gorm:query").Register("instrument:query_start", start)
+	callbacks.Query().After("gorm:query").Register("instrument:query_end", end("query"))
+	callbacks.RowQuery().Before("gorm:row_query").Register("instrument:row_query_start", start)
+	callbacks.RowQuery().After("gorm:row_query").Register("instrument:row_query_end", end("row_query"))
+	callbacks.Update().Before("gorm:update").Register("instrument:update_start", start)
+	callbacks.Update().After("gorm:update").Register("instrument:update_end", end("update"))
+	callbacks.Delete().Before("gorm:delete").Register("instrument:delete_start", start)
+	callbacks.Delete().After("gorm:delete").Register("instrument:delete_end", end("delete"))
+}
+
+// skipsQuery check if the callbacks run without a statement, like on every
+// row of many2many preloads
+func skipsQuery(scope *gorm.Scope) bool {
+	_, skip := scope.InstanceGet("gorm:skip_query_callback")
+	return skip
+}
+
+// queryTable returns the table of the query, raw queries without a model
+// have none
+func queryTable(scope *gorm.Scope) string {
+	if table := scope.TableName(); table != "" {
+		return table
+	}
+	return "raw"
+}
@@ -0,0 +1,966 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MemoryStore is a thread-safe in-memory Datastorer. It follows the
+// semantics of DB and is meant for tests that need isolated fixtures.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	txMu      sync.Mutex
+	users     map[int]User
+	articles  map[int]Article
+	taggings  map[int][]uint
+	tags      map[uint]Tag
+	aliases   map[string]uint
+	favorites map[int]Favorite
+	tokens    map[int]APIToken
+	revisions map[int][]ArticleRevision
+	lastIDs   map[string]int
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:     make(map[int]User),
+		articles:  make(map[int]Article),
+		taggings:  make(map[int][]uint),
+		tags:      make(map[uint]Tag),
+		aliases:   make(map[string]uint),
+		favorites: make(map[int]Favorite),
+		tokens:    make(map[int]APIToken),
+		revisions: make(map[int][]ArticleRevision),
+		lastIDs:   make(map[string]int),
+	}
+}
+
+// InitSchema is a no-op, the store needs no schema
+func (m *MemoryStore) InitSchema() error {
+	return nil
+}
+
+// WithContext returns the store, its operations are not traced
+func (m *MemoryStore) WithContext(context.Context) Datastorer {
+	return m
+}
+
+// WithTx runs fn with the store. Transactions are serialized and a failed
+// transaction restores the state the store had when it began, writes made
+// concurrently outside of a transaction are lost in that case.
+func (m *MemoryStore) WithTx(fn func(Datastorer) error) (err error) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.RLock()
+	snapshot := m.clone()
+	m.mu.RUnlock()
+
+	defer func() {
+		if p := recover(); p != nil {
+			m.restore(snapshot)
+			panic(p)
+		}
+	}()
+
+	if err = fn(memoryTx{m}); err != nil {
+		m.restore(snapshot)
+	}
+	return err
+}
+
+// memoryTx is the Datastorer handed to WithTx callbacks, nested
+// transactions join the running one
+type memoryTx struct {
+	*MemoryStore
+}
+
+func (tx memoryTx) WithTx(fn func(Datastorer) error) error {
+	return fn(tx)
+}
+
+func (tx memoryTx) WithContext(context.Context) Datastorer {
+	return tx
+}
+
+// clone returns a copy of the store data
+func (m *MemoryStore) clone() *MemoryStore {
+	c := NewMemoryStore()
+	for k, v := range m.users {
+		c.users[k] = v
+	}
+	for k, v := range m.articles {
+		c.articles[k] = v
+	}
+	for k, v := range m.taggings {
+		c.taggings[k] = append([]uint(nil), v...)
+	}
+	for k, v := range m.tags {
+		c.tags[k] = v
+	}
+	for k, v := range m.aliases {
+		c.aliases[k] = v
+	}
+	for k, v := range m.favorites {
+		c.favorites[k] = v
+	}
+	for k, v := range m.tokens {
+		c.tokens[k] = v
+	}
+	for k, v := range m.revisions {
+		c.revisions[k] = append([]ArticleRevision(nil), v...)
+	}
+	for k, v := range m.lastIDs {
+		c.lastIDs[k] = v
+	}
+	return c
+}
+
+func (m *MemoryStore) restore(c *MemoryStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users = c.users
+	m.articles = c.articles
+	m.taggings = c.taggings
+	m.tags = c.tags
+	m.aliases = c.aliases
+	m.favorites = c.favorites
+	m.tokens = c.tokens
+	m.revisions = c.revisions
+	m.lastIDs = c.lastIDs
+}
+
+// nextID returns the next auto increment id of the table
+func (m *MemoryStore) nextID(table string) int {
+	m.lastIDs[table]++
+	return m.lastIDs[table]
+}
+
+// Users
+
+func (m *MemoryStore) CreateUser(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			return fmt.Errorf("Email already exisits")
+		}
+		if u.Username == user.Username {
+			return fmt.Errorf("Username already exisits")
+		}
+	}
+
+	user.ID = m.nextID("users")
+	user.CreatedAt = time.Now()
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *MemoryStore) FindUserByEmail(email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("No user found with email: %s", email)
+}
+
+func (m *MemoryStore) FindUserByUsername(username string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return &User{}, gorm.ErrRecordNotFound
+}
+
+func (m *MemoryStore) UpdatePassword(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[user.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.Password = user.Password
+	m.users[u.ID] = u
+	return nil
+}
+
+// Articles
+
+func (m *MemoryStore) CreateArticle(article *Article) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	article.BeforeCreate()
+	if article.User.ID != 0 {
+		article.UserID = article.User.ID
+	}
+
+	now := time.Now()
+	article.ID = m.nextID("articles")
+	article.CreatedAt = now
+	article.UpdatedAt = now
+
+	m.saveTags(article)
+	m.createRevision(article)
+	m.articles[article.ID] = m.stored(article)
+	return nil
+}
+
+func (m *MemoryStore) SaveArticle(article *Article) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.articles[article.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	if stored.Version != article.Version {
+		return ErrVersionConflict
+	}
+
+	article.Version++
+	article.BeforeUpdate()
+	article.FavoritesCount = stored.FavoritesCount
+	article.UpdatedAt = time.Now()
+
+	m.saveTags(article)
+	m.createRevision(article)
+	m.articles[article.ID] = m.stored(article)
+	return nil
+}
+
+func (m *MemoryStore) DeleteArticle(article *Article) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.articles[article.ID]
+	if !ok || a.DeletedAt != nil {
+		return nil
+	}
+
+	if a.Version != article.Version {
+		return ErrVersionConflict
+	}
+
+	now := time.Now()
+	a.DeletedAt = &now
+	article.DeletedAt = &now
+	m.articles[a.ID] = a
+	return nil
+}
+
+func (m *MemoryStore) GetDeletedArticle(slug string) (*Article, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found *Article
+	for _, a := range m.articles {
+		if a.Slug == slug && a.DeletedAt != nil && (found == nil || a.DeletedAt.After(*found.DeletedAt)) {
+			a := m.loaded(a)
+			found = &a
+		}
+	}
+
+	if found == nil {
+		return &Article{}, gorm.ErrRecordNotFound
+	}
+	return found, nil
+}
+
+func (m *MemoryStore) RestoreArticle(article *Article) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.articleBySlug(article.Slug); ok {
+		return errSlugTaken
+	}
+
+	a, ok := m.articles[article.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	a.DeletedAt = nil
+	article.DeletedAt = nil
+	m.articles[a.ID] = a
+	return nil
+}
+
+func (m *MemoryStore) PurgeArticles(deletedBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, a := range m.articles {
+		if a.DeletedAt == nil || !a.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		delete(m.articles, id)
+		delete(m.taggings, id)
+		delete(m.revisions, id)
+		for fid, f := range m.favorites {
+			if f.ArticleID == id {
+				delete(m.favorites, fid)
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) GetArticle(slug string) (*Article, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if a, ok := m.articleBySlug(slug); ok {
+		a := m.loaded(a)
+		return &a, nil
+	}
+	return &Article{}, gorm.ErrRecordNotFound
+}
+
+// articleBySlug returns the article with the slug unless it is deleted
+func (m *MemoryStore) articleBySlug(slug string) (Article, bool) {
+	for _, a := range m.articles {
+		if a.Slug == slug && a.DeletedAt == nil {
+			return a, true
+		}
+	}
+	return Article{}, false
+}
+
+func (m *MemoryStore) GetArticles(q ArticleQuery) ([]Article, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var articles []Article
+	for _, a := range m.articles {
+		if m.matches(a, q) {
+			articles = append(articles, m.loaded(a))
+		}
+	}
+
+	m.sortArticles(articles, q)
+	return paginate(articles, q.Limit, q.Offset), nil
+}
+
+func (m *MemoryStore) GetAllArticlesWithTag(tagName string) ([]Article, error) {
+	return m.GetArticles(ArticleQuery{Tags: []string{tagName}})
+}
+
+func (m *MemoryStore) GetAllArticlesAuthoredBy(username string) ([]Article, error) {
+	return m.GetArticles(ArticleQuery{Author: username})
+}
+
+func (m *MemoryStore) GetAllArticlesFavoritedBy(username string) ([]Article, error) {
+	return m.GetArticles(ArticleQuery{FavoritedBy: username})
+}
+
+func (m *MemoryStore) matches(a Article, q ArticleQuery) bool {
+	if a.DeletedAt != nil {
+		return false
+	}
+
+	if a.Status != StatusPublished && a.UserID != q.ViewerID {
+		return false
+	}
+
+	if len(q.Tags) > 0 {
+		names := m.canonicalTagNames(q.Tags)
+		matched := 0
+		for _, name := range names {
+			if m.hasTag(a.ID, name) {
+				matched++
+			}
+		}
+		if matched == 0 || (q.AllTags && matched < len(names)) {
+			return false
+		}
+	}
+
+	for _, name := range q.ExcludedTags {
+		if m.hasTag(a.ID, m.canonicalTagName(name)) {
+			return false
+		}
+	}
+
+	if !q.Since.IsZero() && a.CreatedAt.Before(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && a.CreatedAt.After(q.Until) {
+		return false
+	}
+
+	if q.Author != "" && m.users[a.UserID].Username != q.Author {
+		return false
+	}
+
+	if q.FavoritedBy != "" {
+		u, ok := m.userByUsername(q.FavoritedBy)
+		if !ok || !m.isFavorited(u.ID, a.ID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *MemoryStore) hasTag(articleID int, tagName string) bool {
+	for _, id := range m.taggings[articleID] {
+		if m.tags[id].Name == tagName {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) userByUsername(username string) (User, bool) {
+	for _, u := range m.users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// saveTags creates the new tags of the article and records its taggings
+func (m *MemoryStore) saveTags(article *Article) {
+	var ids []uint
+	for i := range article.Tags {
+		t := &article.Tags[i]
+		if t.ID == 0 {
+			t.Name = NormalizeTagName(t.Name)
+			if existing, ok := m.tagByName(t.Name); ok {
+				*t = existing
+			} else {
+				t.ID = uint(m.nextID("tags"))
+				m.tags[t.ID] = Tag{ID: t.ID, Name: t.Name}
+			}
+		}
+		ids = append(ids, t.ID)
+	}
+
+	if article.Tags != nil {
+		m.taggings[article.ID] = ids
+	}
+}
+
+// stored strips the associations, only their ids are kept
+func (m *MemoryStore) stored(article *Article) Article {
+	a := *article
+	a.User = User{}
+	a.Tags = nil
+	a.Favorites = nil
+	return a
+}
+
+// loaded returns a copy of the article with its User and Tags preloaded
+func (m *MemoryStore) loaded(a Article) Article {
+	a.User = m.users[a.UserID]
+	a.Tags = nil
+	for _, id := range m.taggings[a.ID] {
+		a.Tags = append(a.Tags, m.tags[id])
+	}
+	return a
+}
+
+func paginate(articles []Article, limit, offset int) []Article {
+	if offset > 0 {
+		if offset >= len(articles) {
+			return nil
+		}
+		articles = articles[offset:]
+	}
+
+	if limit > 0 && limit < len(articles) {
+		articles = articles[:limit]
+	}
+
+	return articles
+}
+
+func (m *MemoryStore) SearchArticles(q SearchQuery) ([]SearchResult, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := searchTerms(q.Query)
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+
+	var articles []Article
+	for _, a := range m.articles {
+		if m.matches(a, ArticleQuery{ViewerID: q.ViewerID}) {
+			articles = append(articles, m.loaded(a))
+		}
+	}
+
+	results := rankArticles(articles, terms)
+	return paginateResults(results, q.Limit, q.Offset), len(results), nil
+}
+
+func (m *MemoryStore) GetRelatedArticles(article *Article, q ArticleQuery) ([]Article, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := make(map[int]float64)
+
+	for _, tagID := range m.taggings[article.ID] {
+		for articleID, ids := range m.taggings {
+			for _, id := range ids {
+				if id == tagID && articleID != article.ID {
+					scores[articleID] += relatedTagWeight
+				}
+			}
+		}
+	}
+
+	for _, f := range m.favorites {
+		if f.ArticleID != article.ID {
+			continue
+		}
+		for _, other := range m.favorites {
+			if other.UserID == f.UserID && other.ArticleID != article.ID {
+				scores[other.ArticleID] += relatedFavoriteWeight
+			}
+		}
+	}
+
+	for id, a := range m.articles {
+		if a.UserID == article.UserID && id != article.ID {
+			scores[id] += relatedAuthorWeight
+		}
+	}
+
+	var articles []Article
+	for id := range scores {
+		a, ok := m.articles[id]
+		if ok && m.matches(a, ArticleQuery{}) && a.UserID != q.ViewerID {
+			articles = append(articles, m.loaded(a))
+		}
+	}
+
+	return rankRelated(articles, scores, q.Limit), nil
+}
+
+// Revisions
+
+func (m *MemoryStore) createRevision(article *Article) {
+	revisions := m.revisions[article.ID]
+	r := NewArticleRevision(article, len(revisions)+1)
+	r.ID = m.nextID("article_revisions")
+	r.CreatedAt = time.Now()
+	m.revisions[article.ID] = append(revisions, r)
+	article.Revision = r.Number
+}
+
+func (m *MemoryStore) GetRevisions(articleID int) ([]ArticleRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var revisions []ArticleRevision
+	for _, r := range m.revisions[articleID] {
+		r.User = m.users[r.UserID]
+		revisions = append(revisions, r)
+	}
+	return revisions, nil
+}
+
+func (m *MemoryStore) GetRevision(articleID int, number int) (*ArticleRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := m.revisions[articleID]
+	if number < 1 || number > len(revisions) {
+		return &ArticleRevision{}, gorm.ErrRecordNotFound
+	}
+
+	r := revisions[number-1]
+	r.User = m.users[r.UserID]
+	return &r, nil
+}
+
+// Favorites
+
+func (m *MemoryStore) IsFavorited(userID int, articleID int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.isFavorited(userID, articleID)
+}
+
+func (m *MemoryStore) isFavorited(userID int, articleID int) bool {
+	for _, f := range m.favorites {
+		if f.UserID == userID && f.ArticleID == articleID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) IsFollowing(userIDFrom int, userIDTo int) bool {
+	// TODO
+	return false
+}
+
+func (m *MemoryStore) FavoritedArticleIDs(userID int, articleIDs []int) (map[int]bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	favorited := make(map[int]bool)
+	for _, id := range articleIDs {
+		if m.isFavorited(userID, id) {
+			favorited[id] = true
+		}
+	}
+	return favorited, nil
+}
+
+func (m *MemoryStore) FollowedUserIDs(userIDFrom int, userIDs []int) (map[int]bool, error) {
+	// TODO
+	return make(map[int]bool), nil
+}
+
+func (m *MemoryStore) FavoriteArticle(userID int, articleID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.isFavorited(userID, articleID) {
+		return errAlreadyFavorited
+	}
+
+	f := Favorite{ID: m.nextID("favorites"), UserID: userID, ArticleID: articleID, CreatedAt: time.Now()}
+	m.favorites[f.ID] = f
+	m.incrementFavoritesCount(articleID, 1)
+	return nil
+}
+
+func (m *MemoryStore) UnfavoriteArticle(userID int, articleID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, f := range m.favorites {
+		if f.UserID == userID && f.ArticleID == articleID {
+			delete(m.favorites, id)
+			m.incrementFavoritesCount(articleID, -1)
+			return nil
+		}
+	}
+	return errNotFavorited
+}
+
+func (m *MemoryStore) incrementFavoritesCount(articleID int, n int) {
+	if a, ok := m.articles[articleID]; ok {
+		a.FavoritesCount += n
+		m.articles[articleID] = a
+	}
+}
+
+func (m *MemoryStore) PublishScheduledArticles(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, a := range m.articles {
+		if a.Status == StatusScheduled && a.PublishAt != nil && !a.PublishAt.After(now) {
+			publishedAt := *a.PublishAt
+			a.Status = StatusPublished
+			a.PublishedAt = &publishedAt
+			m.articles[id] = a
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) ReconcileFavoritesCounts() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[int]int)
+	for _, f := range m.favorites {
+		counts[f.ArticleID]++
+	}
+
+	for id, a := range m.articles {
+		a.FavoritesCount = counts[id]
+		m.articles[id] = a
+	}
+	return nil
+}
+
+// Tags
+
+func (m *MemoryStore) FindTag(tag *Tag) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, id := range m.sortedTagIDs() {
+		t := m.tags[id]
+		if (tag.ID == 0 || tag.ID == t.ID) && (tag.Name == "" || tag.Name == t.Name) {
+			*tag = m.counted(t)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *MemoryStore) FindTags(tags *[]Tag) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	*tags = (*tags)[:0]
+	for _, t := range m.tags {
+		*tags = append(*tags, m.counted(t))
+	}
+	sort.Slice(*tags, func(i, j int) bool { return (*tags)[i].Name < (*tags)[j].Name })
+	return nil
+}
+
+func (m *MemoryStore) FindTagOrInit(tagName string) (Tag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tagName = m.canonicalTagName(tagName)
+	if t, ok := m.tagByName(tagName); ok {
+		return m.counted(t), nil
+	}
+	return Tag{Name: tagName}, nil
+}
+
+func (m *MemoryStore) FindOrCreateTag(tagName string) (Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tagName = m.canonicalTagName(tagName)
+	if t, ok := m.tagByName(tagName); ok {
+		return m.counted(t), nil
+	}
+
+	t := Tag{ID: uint(m.nextID("tags")), Name: tagName}
+	m.tags[t.ID] = t
+	return t, nil
+}
+
+func (m *MemoryStore) CreateTagAlias(alias string, tagName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias = NormalizeTagName(alias)
+	if _, ok := m.tagByName(alias); ok {
+		return errTagNameUsed
+	}
+
+	if _, ok := m.aliases[alias]; ok {
+		return errAliasTaken
+	}
+
+	t, ok := m.tagByName(NormalizeTagName(tagName))
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	m.aliases[alias] = t.ID
+	return nil
+}
+
+func (m *MemoryStore) MergeTags(from string, into string) (*Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, srcFound := m.tagByName(NormalizeTagName(from))
+	dst, dstFound := m.tagByName(NormalizeTagName(into))
+	if !srcFound || !dstFound {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if src.ID == dst.ID {
+		return nil, errSameTag
+	}
+
+	for articleID, ids := range m.taggings {
+		var kept []uint
+		tagged := false
+		for _, id := range ids {
+			if id == src.ID {
+				id = dst.ID
+			}
+			if id == dst.ID {
+				if tagged {
+					continue
+				}
+				tagged = true
+			}
+			kept = append(kept, id)
+		}
+		m.taggings[articleID] = kept
+	}
+
+	for alias, id := range m.aliases {
+		if id == src.ID {
+			m.aliases[alias] = dst.ID
+		}
+	}
+	m.aliases[src.Name] = dst.ID
+	delete(m.tags, src.ID)
+
+	dst = m.counted(dst)
+	return &dst, nil
+}
+
+// counted returns the tag with the number of articles using it, deleted
+// articles left out. It is computed on reads so it can't go stale.
+func (m *MemoryStore) counted(t Tag) Tag {
+	t.TaggingsCount = 0
+	for articleID, ids := range m.taggings {
+		if m.articles[articleID].DeletedAt != nil {
+			continue
+		}
+		for _, id := range ids {
+			if id == t.ID {
+				t.TaggingsCount++
+			}
+		}
+	}
+	return t
+}
+
+// canonicalTagNames resolves the canonical name of every tag, dropping
+// duplicates
+func (m *MemoryStore) canonicalTagNames(names []string) []string {
+	var canonical []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = m.canonicalTagName(name)
+		if !seen[name] {
+			seen[name] = true
+			canonical = append(canonical, name)
+		}
+	}
+	return canonical
+}
+
+// canonicalTagName normalizes a tag name and resolves its alias if any
+func (m *MemoryStore) canonicalTagName(name string) string {
+	name = NormalizeTagName(name)
+	if id, ok := m.aliases[name]; ok {
+		return m.tags[id].Name
+	}
+	return name
+}
+
+func (m *MemoryStore) tagByName(name string) (Tag, bool) {
+	for _, t := range m.tags {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tag{}, false
+}
+
+func (m *MemoryStore) sortedTagIDs() []uint {
+	var ids []uint
+	for id := range m.tags {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Tokens
+
+func (m *MemoryStore) CreateAPIToken(token *APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.tokens {
+		if t.TokenHash == token.TokenHash {
+			return fmt.Errorf("Token already exists")
+		}
+	}
+
+	if token.User.ID != 0 {
+		token.UserID = token.User.ID
+	}
+	token.ID = m.nextID("api_tokens")
+	token.CreatedAt = time.Now()
+
+	t := *token
+	t.User = User{}
+	m.tokens[t.ID] = t
+	return nil
+}
+
+func (m *MemoryStore) FindAPITokens(userID int) ([]APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tokens []APIToken
+	for _, t := range m.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (m *MemoryStore) FindAPITokenByHash(hash string) (*APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, t := range m.tokens {
+		if t.TokenHash == hash {
+			t.User = m.users[t.UserID]
+			return &t, nil
+		}
+	}
+	return &APIToken{}, gorm.ErrRecordNotFound
+}
+
+func (m *MemoryStore) TouchAPIToken(token *APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[token.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+	token.LastUsedAt = &now
+	t.LastUsedAt = &now
+	m.tokens[t.ID] = t
+	return nil
+}
+
+func (m *MemoryStore) RevokeAPIToken(userID int, tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[tokenID]
+	if !ok || t.UserID != userID {
+		return fmt.Errorf("No token found with id: %d", tokenID)
+	}
+	delete(m.tokens, tokenID)
+	return nil
+}
@@ -0,0 +1,343 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migration is a versioned schema change. Up and Down run inside a
+// transaction, Down must undo everything Up did.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(*gorm.DB) error
+	Down    func(*gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table
+type SchemaMigration struct {
+	Version   int `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// MigrationStatus reports whether a known migration was applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns every known migration ordered by version
+func Migrations() []Migration {
+	ms := make([]Migration, len(migrations))
+	copy(ms, migrations)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms
+}
+
+func (db *DB) ensureMigrationsTable() error {
+	if db.HasTable(&SchemaMigration{}) {
+		return nil
+	}
+	return db.CreateTable(&SchemaMigration{}).Error
+}
+
+func (db *DB) appliedMigrations() (map[int]SchemaMigration, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// MigrateUp applies every pending migration and returns how many were applied
+func (db *DB) MigrateUp() (int, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, m := range Migrations() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := db.runMigration(m, m.Up, func(tx *gorm.DB) error {
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return n, fmt.Errorf("Migration %d %s failed: %v", m.Version, m.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// MigrateDown reverts the last steps applied migrations and returns
+// how many were reverted
+func (db *DB) MigrateDown(steps int) (int, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	ms := Migrations()
+	n := 0
+	for i := len(ms) - 1; i >= 0 && n < steps; i-- {
+		m := ms[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		err := db.runMigration(m, m.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{Version: m.Version}).Error
+		})
+		if err != nil {
+			return n, fmt.Errorf("Migration %d %s rollback failed: %v", m.Version, m.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// MigrationStatus lists every known migration and whether it was applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, m := range Migrations() {
+		row, ok := applied[m.Version]
+		status = append(status, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: row.AppliedAt,
+		})
+	}
+	return status, nil
+}
+
+func (db *DB) runMigration(m Migration, step func(*gorm.DB) error, record func(*gorm.DB) error) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := step(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// dropColumns drops columns of table. SQLite only supports DROP COLUMN
+// since 3.35, newer than the one bundled with some go-sqlite3 versions,
+// so SQLite tables are rebuilt without the columns instead.
+func dropColumns(tx *gorm.DB, table string, columns ...string) error {
+	if tx.Dialect().GetName() == "sqlite3" {
+		return rebuildSQLiteTable(tx, table, columns)
+	}
+
+	for _, column := range columns {
+		if err := tx.Table(table).DropColumn(column).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteColumn is a row of PRAGMA table_info
+type sqliteColumn struct {
+	name    string
+	typ     string
+	notNull bool
+	dflt    sql.NullString
+	pk      int
+}
+
+// rebuildSQLiteTable recreates table without the dropped columns, following
+// https://www.sqlite.org/lang_altertable.html#otheralter. Its rows, primary
+// key, unique constraints, indexes and triggers are kept, indexes on the
+// dropped columns must be removed beforehand.
+func rebuildSQLiteTable(tx *gorm.DB, table string, dropped []string) error {
+	isDropped := make(map[string]bool)
+	for _, column := range dropped {
+		isDropped[column] = true
+	}
+
+	var columns []sqliteColumn
+	rows, err := tx.Raw("PRAGMA table_info(" + quoteIdent(table) + ")").Rows()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c sqliteColumn
+		var cid int
+		if err := rows.Scan(&cid, &c.name, &c.typ, &c.notNull, &c.dflt, &c.pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if !isDropped[c.name] {
+			columns = append(columns, c)
+		}
+	}
+	rows.Close()
+
+	var createSQL string
+	if err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Row().Scan(&createSQL); err != nil {
+		return err
+	}
+	autoIncrement := strings.Contains(strings.ToLower(createSQL), "autoincrement")
+
+	unique, err := sqliteUniqueConstraints(tx, table)
+	if err != nil {
+		return err
+	}
+
+	// Indexes and triggers are dropped along with the table
+	var schema []string
+	if err := tx.Raw(`SELECT sql FROM sqlite_master
+		WHERE type IN ('index', 'trigger') AND tbl_name = ? AND sql IS NOT NULL`, table).Pluck("sql", &schema).Error; err != nil {
+		return err
+	}
+
+	var pks []string
+	for _, c := range columns {
+		if c.pk > 0 {
+			pks = append(pks, quoteIdent(c.name))
+		}
+	}
+
+	var defs, names []string
+	for _, c := range columns {
+		def := quoteIdent(c.name) + " " + c.typ
+		if c.pk > 0 && len(pks) == 1 {
+			def += " PRIMARY KEY"
+			if autoIncrement {
+				def += " AUTOINCREMENT"
+			}
+		}
+		if c.notNull {
+			def += " NOT NULL"
+		}
+		if c.dflt.Valid {
+			def += " DEFAULT " + c.dflt.String
+		}
+		defs = append(defs, def)
+		names = append(names, quoteIdent(c.name))
+	}
+	if len(pks) > 1 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(pks, ", ")+")")
+	}
+	for _, columns := range unique {
+		keep := true
+		for _, column := range columns {
+			keep = keep && !isDropped[column]
+		}
+		if keep {
+			defs = append(defs, "UNIQUE ("+strings.Join(quoteIdents(columns), ", ")+")")
+		}
+	}
+
+	rebuilt := table + "_rebuilt"
+	statements := []string{
+		"CREATE TABLE " + quoteIdent(rebuilt) + " (" + strings.Join(defs, ", ") + ")",
+		"INSERT INTO " + quoteIdent(rebuilt) + " (" + strings.Join(names, ", ") + ") SELECT " + strings.Join(names, ", ") + " FROM " + quoteIdent(table),
+		"DROP TABLE " + quoteIdent(table),
+		"ALTER TABLE " + quoteIdent(rebuilt) + " RENAME TO " + quoteIdent(table),
+	}
+	for _, statement := range append(statements, schema...) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteUniqueConstraints returns the columns of the UNIQUE constraints of
+// table, they are backed by automatic indexes missing from sqlite_master
+func sqliteUniqueConstraints(tx *gorm.DB, table string) ([][]string, error) {
+	type index struct {
+		name   string
+		unique bool
+		origin string
+	}
+
+	var indexes []index
+	rows, err := tx.Raw("PRAGMA index_list(" + quoteIdent(table) + ")").Rows()
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var idx index
+		var seq int
+		var partial bool
+		if err := rows.Scan(&seq, &idx.name, &idx.unique, &idx.origin, &partial); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if idx.origin == "u" {
+			indexes = append(indexes, idx)
+		}
+	}
+	rows.Close()
+
+	var constraints [][]string
+	for _, idx := range indexes {
+		var columns []string
+		rows, err := tx.Raw("PRAGMA index_info(" + quoteIdent(idx.name) + ")").Rows()
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var seqno, cid int
+			var name string
+			if err := rows.Scan(&seqno, &cid, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			columns = append(columns, name)
+		}
+		rows.Close()
+		constraints = append(constraints, columns)
+	}
+	return constraints, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdents(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return quoted
+}
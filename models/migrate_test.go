@@ -0,0 +1,237 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDB connects to the database pointed at by TEST_DATABASE_URL,
+// or to a fresh SQLite file when it is unset. The schema is dropped
+// once the test is done so every test starts from an empty database.
+func newTestDB(t *testing.T) *DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		dir, err := ioutil.TempDir("", "conduit")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		dsn = filepath.Join(dir, "conduit_test.db")
+	}
+
+	config, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.CleanDatabase()
+		db.Close()
+	})
+
+	return db
+}
+
+func TestMigrate_UpAndDown(t *testing.T) {
+	db := newTestDB(t)
+	head := len(Migrations())
+
+	n, err := db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != head {
+		t.Errorf("should apply every migration: got %v want %v", n, head)
+	}
+
+	for _, table := range []string{"users", "articles", "tags", "taggings", "favorites", "api_tokens"} {
+		if !db.HasTable(table) {
+			t.Errorf("should create the %s table", table)
+		}
+	}
+
+	if n, _ := db.MigrateUp(); n != 0 {
+		t.Errorf("should not apply migrations twice: got %v want %v", n, 0)
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range status {
+		if !m.Applied {
+			t.Errorf("migration %d should be applied", m.Version)
+		}
+	}
+
+	n, err = db.MigrateDown(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != head {
+		t.Errorf("should revert every migration: got %v want %v", n, head)
+	}
+
+	for _, table := range []string{"users", "articles", "tags", "taggings", "favorites", "api_tokens"} {
+		if db.HasTable(table) {
+			t.Errorf("should drop the %s table", table)
+		}
+	}
+}
+
+func TestMigrate_DownOneStep(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := status[len(status)-1]
+	if last.Applied {
+		t.Errorf("should revert only the last migration: %d still applied", last.Version)
+	}
+
+	if len(status) > 1 && !status[len(status)-2].Applied {
+		t.Errorf("should keep the previous migrations applied")
+	}
+}
+
+// The tables the AutoMigrate based InitSchema created before versioned
+// migrations
+type legacyUser struct {
+	ID        int
+	CreatedAt time.Time
+	Username  string
+	Email     string
+	Password  string
+	Bio       string
+	Image     string
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+type legacyArticle struct {
+	ID             int
+	Slug           string
+	Title          string
+	Description    string
+	Body           string
+	UserID         int
+	FavoritesCount int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (legacyArticle) TableName() string { return "articles" }
+
+type legacyTag struct {
+	ID            uint
+	Name          string `gorm:"unique"`
+	TaggingsCount uint
+}
+
+func (legacyTag) TableName() string { return "tags" }
+
+type legacyTagging struct {
+	ArticleID int  `gorm:"primary_key;auto_increment:false"`
+	TagID     uint `gorm:"primary_key;auto_increment:false"`
+}
+
+func (legacyTagging) TableName() string { return "taggings" }
+
+type legacyFavorite struct {
+	ID        int
+	UserID    int
+	ArticleID int
+}
+
+func (legacyFavorite) TableName() string { return "favorites" }
+
+func TestMigrate_AdoptsLegacySchema(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.AutoMigrate(&legacyFavorite{}, &legacyUser{}, &legacyArticle{}, &legacyTag{}, &legacyTagging{}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := legacyUser{Username: "legacy", Email: "legacy@example.com", Password: "hash"}
+	db.Create(&u)
+	a := legacyArticle{Slug: "legacy", Title: "Legacy", Description: "Description", Body: "Body", UserID: u.ID}
+	db.Create(&a)
+	// Duplicates left by concurrent favorites before the unique index
+	db.Create(&legacyFavorite{UserID: u.ID, ArticleID: a.ID})
+	db.Create(&legacyFavorite{UserID: u.ID, ArticleID: a.ID})
+
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	article, err := db.GetArticle("legacy")
+	if err != nil {
+		t.Fatalf("should keep the existing articles: %v", err)
+	}
+	if article.User.Username != "legacy" || article.FavoritesCount != 1 {
+		t.Errorf("should migrate the existing data: got %v %v", article.User.Username, article.FavoritesCount)
+	}
+}
+
+func TestMigrate_DownKeepsData(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+
+	// add_articles_status drops columns, next to indexes to keep
+	if _, err := db.MigrateDown(7); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	db.Table("articles").Count(&count)
+	if count != 5 {
+		t.Errorf("should keep the articles: got %v want %v", count, 5)
+	}
+
+	if db.Dialect().HasColumn("articles", "status") {
+		t.Errorf("should drop the status column")
+	}
+	if !db.Dialect().HasIndex("articles", "idx_articles_deleted_at") {
+		t.Errorf("should keep the indexes of the remaining columns")
+	}
+
+	// New rows must not reuse the ids of the kept ones
+	if err := db.Exec("INSERT INTO articles (slug, title) VALUES (?, ?)", "new", "New").Error; err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	db.Table("articles").Where("slug = ?", "new").Select("id").Row().Scan(&id)
+	if id <= 5 {
+		t.Errorf("should keep the primary key: got id %v", id)
+	}
+
+	if _, err := db.MigrateUp(); err != nil {
+		t.Errorf("should migrate up again: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migrations holds the schema history. Each migration declares its own
+// snapshot of the tables it touches so later changes to the models
+// don't rewrite past migrations.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_initial_schema",
+		Up: func(tx *gorm.DB) error {
+			type user struct {
+				ID        int
+				CreatedAt time.Time
+				Username  string
+				Email     string
+				Password  string
+				Bio       string
+				Image     string
+			}
+
+			type article struct {
+				ID             int
+				Slug           string
+				Title          string
+				Description    string
+				Body           string
+				UserID         int
+				FavoritesCount int
+				CreatedAt      time.Time
+				UpdatedAt      time.Time
+			}
+
+			type tag struct {
+				ID            uint
+				Name          string `gorm:"unique"`
+				TaggingsCount uint
+			}
+
+			type tagging struct {
+				ArticleID int  `gorm:"primary_key;auto_increment:false"`
+				TagID     uint `gorm:"primary_key;auto_increment:false"`
+			}
+
+			type favorite struct {
+				ID        int
+				UserID    int
+				ArticleID int
+			}
+
+			// Databases created by the AutoMigrate based InitSchema, before
+			// versioned migrations, already have these tables. AutoMigrate
+			// only creates the missing ones, adopting the existing schema.
+			return tx.AutoMigrate(&user{}, &article{}, &tag{}, &tagging{}, &favorite{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("favorites", "taggings", "tags", "articles", "users").Error
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_api_tokens",
+		Up: func(tx *gorm.DB) error {
+			type apiToken struct {
+				ID         int
+				UserID     int `gorm:"index"`
+				Name       string
+				TokenHash  string `gorm:"unique_index"`
+				Scopes     string
+				LastUsedAt *time.Time
+				CreatedAt  time.Time
+			}
+
+			return tx.Table("api_tokens").CreateTable(&apiToken{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("api_tokens").Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "widen_article_text_columns",
+		// MySQL maps strings to varchar(255), too short for article bodies.
+		// SQLite and Postgres already use text columns.
+		Up: func(tx *gorm.DB) error {
+			if tx.Dialect().GetName() != "mysql" {
+				return nil
+			}
+			return tx.Table("articles").
+				ModifyColumn("description", "text").
+				ModifyColumn("body", "longtext").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Dialect().GetName() != "mysql" {
+				return nil
+			}
+			return tx.Table("articles").
+				ModifyColumn("description", "varchar(255)").
+				ModifyColumn("body", "varchar(255)").Error
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_favorites_unique_index",
+		Up: func(tx *gorm.DB) error {
+			// Drop the duplicates left by concurrent favorites before
+			// enforcing uniqueness. The derived table keeps MySQL from
+			// rejecting a subquery on the table being deleted from.
+			err := tx.Exec(`DELETE FROM favorites WHERE id NOT IN (
+				SELECT id FROM (
+					SELECT MIN(id) AS id FROM favorites GROUP BY user_id, article_id
+				) AS keep
+			)`).Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Table("favorites").
+				AddUniqueIndex("idx_favorites_user_article", "user_id", "article_id").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Table("favorites").RemoveIndex("idx_favorites_user_article").Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "backfill_favorites_count",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec(reconcileFavoritesCountsSQL).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_articles_deleted_at",
+		Up: func(tx *gorm.DB) error {
+			type article struct {
+				DeletedAt *time.Time
+			}
+
+			if err := tx.AutoMigrate(&article{}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&article{}).AddIndex("idx_articles_deleted_at", "deleted_at").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("articles").RemoveIndex("idx_articles_deleted_at").Error; err != nil {
+				return err
+			}
+			return dropColumns(tx, "articles", "deleted_at")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_article_revisions",
+		Up: func(tx *gorm.DB) error {
+			type articleRevision struct {
+				ID          int
+				ArticleID   int `gorm:"unique_index:idx_article_revisions_number"`
+				Number      int `gorm:"unique_index:idx_article_revisions_number"`
+				UserID      int
+				Title       string
+				Description string `gorm:"type:text"`
+				Body        string `gorm:"type:text"`
+				CreatedAt   time.Time
+			}
+
+			if err := tx.CreateTable(&articleRevision{}).Error; err != nil {
+				return err
+			}
+
+			// Existing articles start their history with their current content
+			return tx.Exec(`INSERT INTO article_revisions
+				(article_id, number, user_id, title, description, body, created_at)
+				SELECT id, 1, user_id, title, description, body, updated_at FROM articles`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("article_revisions").Error
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_articles_status",
+		Up: func(tx *gorm.DB) error {
+			type article struct {
+				Status      string `gorm:"default:'published'"`
+				PublishAt   *time.Time
+				PublishedAt *time.Time
+			}
+
+			if err := tx.AutoMigrate(&article{}).Error; err != nil {
+				return err
+			}
+
+			// Every existing article was public from its creation
+			err := tx.Exec("UPDATE articles SET status = ?, published_at = created_at", StatusPublished).Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Model(&article{}).AddIndex("idx_articles_status", "status").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("articles").RemoveIndex("idx_articles_status").Error; err != nil {
+				return err
+			}
+			return dropColumns(tx, "articles", "status", "publish_at", "published_at")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_articles_revision",
+		Up: func(tx *gorm.DB) error {
+			type article struct {
+				Revision int `gorm:"not null;default:0"`
+			}
+
+			if err := tx.AutoMigrate(&article{}).Error; err != nil {
+				return err
+			}
+
+			return tx.Exec(`UPDATE articles SET revision = (
+				SELECT COALESCE(MAX(number), 0) FROM article_revisions
+				WHERE article_revisions.article_id = articles.id)`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "articles", "revision")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_articles_fts",
+		Up: func(tx *gorm.DB) error {
+			if tx.Dialect().GetName() != "sqlite3" {
+				return nil
+			}
+
+			err := tx.Exec(`CREATE VIRTUAL TABLE articles_fts
+				USING fts5(title, description, body, tags, tokenize = 'porter unicode61')`).Error
+			if err != nil && strings.Contains(err.Error(), "no such module") {
+				// go-sqlite3 was built without the sqlite_fts5 tag, search
+				// falls back to LIKE queries
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			return tx.Exec(`INSERT INTO articles_fts (rowid, title, description, body, tags)
+				SELECT articles.id, articles.title, articles.description, articles.body,
+					COALESCE((SELECT group_concat(tags.name, ' ') FROM taggings
+						JOIN tags ON tags.id = taggings.tag_id
+						WHERE taggings.article_id = articles.id), '')
+				FROM articles WHERE articles.deleted_at IS NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TABLE IF EXISTS articles_fts").Error
+		},
+	},
+	{
+		Version: 11,
+		Name:    "normalize_tags",
+		Up: func(tx *gorm.DB) error {
+			type tagAlias struct {
+				ID    uint
+				Name  string `gorm:"unique"`
+				TagID uint   `gorm:"index"`
+			}
+
+			if err := tx.CreateTable(&tagAlias{}).Error; err != nil {
+				return err
+			}
+
+			type tag struct {
+				ID   uint
+				Name string
+			}
+
+			var tags []tag
+			if err := tx.Order("id").Find(&tags).Error; err != nil {
+				return err
+			}
+
+			// The oldest tag of every normalized name is kept and the
+			// others are merged into it
+			kept := make(map[string]uint)
+			for _, t := range tags {
+				name := NormalizeTagName(t.Name)
+				id, ok := kept[name]
+				if !ok {
+					kept[name] = t.ID
+					continue
+				}
+
+				var tagged []int
+				if err := tx.Table("taggings").Where("tag_id = ?", id).Pluck("article_id", &tagged).Error; err != nil {
+					return err
+				}
+				if len(tagged) > 0 {
+					err := tx.Exec("DELETE FROM taggings WHERE tag_id = ? AND article_id IN (?)", t.ID, tagged).Error
+					if err != nil {
+						return err
+					}
+				}
+				if err := tx.Exec("UPDATE taggings SET tag_id = ? WHERE tag_id = ?", id, t.ID).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("DELETE FROM tags WHERE id = ?", t.ID).Error; err != nil {
+					return err
+				}
+			}
+
+			// Normalized names are their own normal form so renaming
+			// can't collide with a tag that is still to be renamed
+			for name, id := range kept {
+				if err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", name, id).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Exec(recountTaggingsSQL).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("tag_aliases").Error
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_article_sort_indexes",
+		Up: func(tx *gorm.DB) error {
+			type favorite struct {
+				CreatedAt *time.Time
+			}
+
+			if err := tx.AutoMigrate(&favorite{}).Error; err != nil {
+				return err
+			}
+
+			// When existing favorites were made is unknown, the article
+			// creation is the earliest it could have been
+			err := tx.Exec(`UPDATE favorites SET created_at =
+				(SELECT created_at FROM articles WHERE articles.id = favorites.article_id)`).Error
+			if err != nil {
+				return err
+			}
+
+			indexes := []struct {
+				table   string
+				name    string
+				columns []string
+			}{
+				{"favorites", "idx_favorites_created_at", []string{"created_at", "article_id"}},
+				{"articles", "idx_articles_created_at", []string{"created_at"}},
+				{"articles", "idx_articles_favorites_count", []string{"favorites_count"}},
+			}
+			for _, idx := range indexes {
+				if err := tx.Table(idx.table).AddIndex(idx.name, idx.columns...).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			indexes := []struct{ table, name string }{
+				{"articles", "idx_articles_favorites_count"},
+				{"articles", "idx_articles_created_at"},
+				{"favorites", "idx_favorites_created_at"},
+			}
+			for _, idx := range indexes {
+				if err := tx.Table(idx.table).RemoveIndex(idx.name).Error; err != nil {
+					return err
+				}
+			}
+			return dropColumns(tx, "favorites", "created_at")
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_articles_version",
+		Up: func(tx *gorm.DB) error {
+			type article struct {
+				Version int `gorm:"not null;default:1"`
+			}
+
+			return tx.AutoMigrate(&article{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, "articles", "version")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "backfill_taggings_count",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec(recountTaggingsSQL).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+}
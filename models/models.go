@@ -1,6 +1,8 @@
 package models
 
 import (
+	"context"
+
 	"github.com/jinzhu/gorm"
 )
 
@@ -8,7 +10,15 @@ type Datastorer interface {
 	UserStorer
 	ArticleStorer
 	TagStorer
-	InitSchema()
+	TokenStorer
+	RevisionStorer
+	SearchStorer
+	RelatedStorer
+	InitSchema() error
+	WithTx(func(Datastorer) error) error
+	// WithContext returns the store running its queries for ctx, traced
+	// as children of its span
+	WithContext(ctx context.Context) Datastorer
 }
 
 type DB struct {
@@ -24,10 +34,27 @@ func NewDB(dialect, dbName string) (*DB, error) {
 	return &DB{db}, nil
 }
 
-func (db *DB) InitSchema() {
-	db.AutoMigrate(&Favorite{})
-	db.AutoMigrate(&User{})
-	db.AutoMigrate(&Article{})
-	db.AutoMigrate(&Tag{})
+// contextSetting is the gorm setting holding the context of the queries
+const contextSetting = "conduit:context"
+
+// WithContext returns the DB running its queries, and its transactions, for
+// ctx
+func (db *DB) WithContext(ctx context.Context) Datastorer {
+	return &DB{db.DB.Set(contextSetting, ctx)}
+}
+
+// queryContext returns the context given to WithContext
+func queryContext(scope *gorm.Scope) context.Context {
+	if v, ok := scope.Get(contextSetting); ok {
+		if ctx, ok := v.(context.Context); ok {
+			return ctx
+		}
+	}
+	return context.Background()
+}
 
+// InitSchema applies every pending migration
+func (db *DB) InitSchema() error {
+	_, err := db.MigrateUp()
+	return err
 }
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes passwords into a self-describing format, so a hash can be
+// verified and checked for outdated parameters without any other context.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) bool
+	// Identifies check if the hash was produced by this algorithm
+	Identifies(hash string) bool
+	// NeedsRehash check if the hash uses other parameters than the hasher
+	NeedsRehash(hash string) bool
+}
+
+// PasswordHasher is used to hash every new password. Hashes produced by any
+// of the supported algorithms are still verified.
+var PasswordHasher Hasher = NewBcryptHasher(bcrypt.DefaultCost)
+
+var hashers = []Hasher{&BcryptHasher{}, &Argon2idHasher{}}
+
+// NewPasswordHasher returns the hasher for the given algorithm name,
+// bcrypt or argon2id. An empty name selects bcrypt.
+func NewPasswordHasher(name string, bcryptCost int) (Hasher, error) {
+	switch name {
+	case "", "bcrypt":
+		if bcryptCost == 0 {
+			bcryptCost = bcrypt.DefaultCost
+		}
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("Invalid bcrypt cost: %d", bcryptCost)
+		}
+		return NewBcryptHasher(bcryptCost), nil
+	case "argon2id":
+		return NewArgon2idHasher(), nil
+	}
+	return nil, fmt.Errorf("Unknown password hasher: %s", name)
+}
+
+// VerifyPassword check the password against a hash produced
+// by any of the supported hashers
+func VerifyPassword(hash, password string) bool {
+	for _, h := range hashers {
+		if h.Identifies(hash) {
+			return h.Verify(hash, password)
+		}
+	}
+	return false
+}
+
+// PasswordNeedsRehash check if the hash should be replaced
+// by one produced by PasswordHasher
+func PasswordNeedsRehash(hash string) bool {
+	return !PasswordHasher.Identifies(hash) || PasswordHasher.NeedsRehash(hash)
+}
+
+// BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *BcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (b *BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+func (b *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
+
+// Argon2idHasher hashes passwords with argon2id using the PHC string format
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// NewArgon2idHasher returns a hasher using the RFC 9106 second
+// recommended parameters
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2idHasher) Verify(hash, password string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (a *Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Time != a.Time ||
+		params.Memory != a.Memory ||
+		params.Threads != a.Threads ||
+		uint32(len(key)) != a.KeyLen ||
+		uint32(len(salt)) != a.SaltLen
+}
+
+func decodeArgon2id(hash string) (params Argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		err = fmt.Errorf("Invalid argon2id hash")
+		return
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = fmt.Errorf("Unsupported argon2 version: %d", version)
+		return
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	return
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := NewBcryptHasher(bcrypt.MinCost)
+
+	hash, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasher.Identifies(hash) {
+		t.Errorf("should identify its own hash: got %v", hash)
+	}
+
+	if !hasher.Verify(hash, "secret") {
+		t.Errorf("should verify the correct password")
+	}
+
+	if hasher.Verify(hash, "wrong") {
+		t.Errorf("should not verify a wrong password")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Errorf("should not need a rehash with the same cost")
+	}
+
+	if !NewBcryptHasher(bcrypt.MinCost + 1).NeedsRehash(hash) {
+		t.Errorf("should need a rehash with another cost")
+	}
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := &Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+	hash, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("should produce a PHC formatted hash: got %v", hash)
+	}
+
+	if !hasher.Verify(hash, "secret") {
+		t.Errorf("should verify the correct password")
+	}
+
+	if hasher.Verify(hash, "wrong") {
+		t.Errorf("should not verify a wrong password")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Errorf("should not need a rehash with the same parameters")
+	}
+
+	stronger := *hasher
+	stronger.Time = 2
+	if !stronger.NeedsRehash(hash) {
+		t.Errorf("should need a rehash with other parameters")
+	}
+}
+
+func TestUser_PasswordUpgrade(t *testing.T) {
+	defer func(h Hasher) { PasswordHasher = h }(PasswordHasher)
+
+	PasswordHasher = NewBcryptHasher(bcrypt.MinCost)
+	u, err := NewUser("upgrade@example.com", "upgrade", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	PasswordHasher = &Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+	if !u.MatchPassword("secret") {
+		t.Errorf("should still match a bcrypt hash once argon2id is configured")
+	}
+
+	if !u.PasswordNeedsRehash() {
+		t.Errorf("should need a rehash when the algorithm changed")
+	}
+
+	if err := u.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if u.PasswordNeedsRehash() || !u.MatchPassword("secret") {
+		t.Errorf("should match and be up to date after the rehash")
+	}
+}
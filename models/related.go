@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+)
+
+type RelatedStorer interface {
+	GetRelatedArticles(*Article, ArticleQuery) ([]Article, error)
+}
+
+// Weights of the signals relating two articles
+const (
+	relatedTagWeight      = 3.0
+	relatedFavoriteWeight = 2.0
+	relatedAuthorWeight   = 1.0
+)
+
+// relatedCandidates bounds the number of candidates each signal yields
+const relatedCandidates = 100
+
+// GetRelatedArticles returns the published articles related to article,
+// best first. They are scored by the tags they share with it, by how many
+// users favorited both and by being from the same author. The article
+// itself and the articles of q.ViewerID are excluded, only q.Limit is
+// used from the rest of the query.
+func (db *DB) GetRelatedArticles(article *Article, q ArticleQuery) ([]Article, error) {
+	scores := make(map[int]float64)
+
+	rows, err := db.Raw(`SELECT t2.article_id, COUNT(*) FROM taggings t1
+		JOIN taggings t2 ON t2.tag_id = t1.tag_id
+		WHERE t1.article_id = ? AND t2.article_id <> ?
+		GROUP BY t2.article_id ORDER BY 2 DESC LIMIT ?`,
+		article.ID, article.ID, relatedCandidates).Rows()
+	if err := addScores(scores, rows, err, relatedTagWeight); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Raw(`SELECT f2.article_id, COUNT(*) FROM favorites f1
+		JOIN favorites f2 ON f2.user_id = f1.user_id
+		WHERE f1.article_id = ? AND f2.article_id <> ?
+		GROUP BY f2.article_id ORDER BY 2 DESC LIMIT ?`,
+		article.ID, article.ID, relatedCandidates).Rows()
+	if err := addScores(scores, rows, err, relatedFavoriteWeight); err != nil {
+		return nil, err
+	}
+
+	var authored []int
+	err = db.Model(&Article{}).
+		Where("user_id = ? AND id <> ?", article.UserID, article.ID).
+		Order("created_at desc").
+		Limit(relatedCandidates).
+		Pluck("id", &authored).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range authored {
+		scores[id] += relatedAuthorWeight
+	}
+
+	if len(scores) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+
+	var articles []Article
+	err = db.Scopes(defaultScope).
+		Where("articles.id IN (?) AND articles.status = ? AND articles.user_id <> ?", ids, StatusPublished, q.ViewerID).
+		Find(&articles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return rankRelated(articles, scores, q.Limit), nil
+}
+
+// addScores adds weight times the count of every (article_id, count) row
+func addScores(scores map[int]float64, rows *sql.Rows, err error, weight float64) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		scores[id] += weight * float64(count)
+	}
+	return rows.Err()
+}
+
+// rankRelated sorts the articles by score, then newest first, and keeps
+// the limit first ones
+func rankRelated(articles []Article, scores map[int]float64, limit int) []Article {
+	sort.Slice(articles, func(i, j int) bool {
+		a, b := articles[i], articles[j]
+		if scores[a.ID] != scores[b.ID] {
+			return scores[a.ID] > scores[b.ID]
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+
+	return paginate(articles, limit, 0)
+}
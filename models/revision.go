@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+type RevisionStorer interface {
+	GetRevisions(int) ([]ArticleRevision, error)
+	GetRevision(int, int) (*ArticleRevision, error)
+}
+
+// ArticleRevision is a snapshot of an article taken every time it is
+// created or saved. Revisions of an article are numbered from 1.
+type ArticleRevision struct {
+	ID          int
+	ArticleID   int `gorm:"unique_index:idx_article_revisions_number"`
+	Number      int `gorm:"unique_index:idx_article_revisions_number"`
+	User        User
+	UserID      int
+	Title       string
+	Description string
+	Body        string
+	CreatedAt   time.Time
+}
+
+// NewArticleRevision returns a snapshot of the article current content
+func NewArticleRevision(a *Article, number int) ArticleRevision {
+	return ArticleRevision{
+		ArticleID:   a.ID,
+		Number:      number,
+		UserID:      a.UserID,
+		Title:       a.Title,
+		Description: a.Description,
+		Body:        a.Body,
+	}
+}
+
+// GetRevisions returns the revisions of an article, oldest first
+func (db *DB) GetRevisions(articleID int) (revisions []ArticleRevision, err error) {
+	err = db.Preload("User").
+		Where("article_id = ?", articleID).
+		Order("number").
+		Find(&revisions).Error
+	return
+}
+
+// GetRevision returns the revision of an article with the given number
+func (db *DB) GetRevision(articleID int, number int) (*ArticleRevision, error) {
+	var revision ArticleRevision
+	err := db.Preload("User").
+		First(&revision, "article_id = ? AND number = ?", articleID, number).Error
+	return &revision, err
+}
+
+// createRevision records the article current content as its next revision
+func (db *DB) createRevision(article *Article) error {
+	var last int
+	err := db.Model(&ArticleRevision{}).
+		Select("COALESCE(MAX(number), 0)").
+		Where("article_id = ?", article.ID).
+		Row().Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	revision := NewArticleRevision(article, last+1)
+	if err := db.Create(&revision).Error; err != nil {
+		return err
+	}
+
+	return db.Model(article).UpdateColumn("revision", revision.Number).Error
+}
@@ -0,0 +1,379 @@
+package models
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type SearchStorer interface {
+	SearchArticles(SearchQuery) ([]SearchResult, int, error)
+}
+
+// SearchQuery describes a full text search over the articles the viewer
+// can list
+type SearchQuery struct {
+	Query    string
+	ViewerID int
+	Limit    int
+	Offset   int
+}
+
+// SearchResult is an article matching a search with its relevance and an
+// HTML snippet of the matching text, matches are wrapped in <mark>
+type SearchResult struct {
+	Article Article
+	Rank    float64
+	Snippet string
+}
+
+// Weights of the searched fields, used by both the FTS5 bm25 ranking and
+// the portable fallback
+const (
+	searchTitleWeight       = 10.0
+	searchDescriptionWeight = 5.0
+	searchBodyWeight        = 1.0
+	searchTagsWeight        = 8.0
+)
+
+// searchCandidateLimit bounds the articles the LIKE fallback loads and
+// ranks in Go. Past it, only the most recent matches are searched.
+var searchCandidateLimit = 1000
+
+// snippetTokens is the number of words in a search snippet
+const snippetTokens = 16
+
+// Markers delimiting the matches in a snippet before it is escaped
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// SearchArticles returns the articles matching every word of the query,
+// most relevant first, and the total number of matches. It uses the
+// articles_fts FTS5 table when available and falls back to LIKE queries
+// ranked in Go otherwise, over the searchCandidateLimit most recent matches.
+func (db *DB) SearchArticles(q SearchQuery) ([]SearchResult, int, error) {
+	terms := searchTerms(q.Query)
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+
+	if db.hasFullTextIndex() {
+		return db.searchFullText(q, terms)
+	}
+
+	query := db.Scopes(defaultScope).
+		Where("articles.status = ? OR articles.user_id = ?", StatusPublished, q.ViewerID)
+
+	for _, term := range terms {
+		like := "%" + term + "%"
+		query = query.Where(
+			"LOWER(articles.title) LIKE ? OR LOWER(articles.description) LIKE ? OR LOWER(articles.body) LIKE ? OR articles.id IN ?",
+			like, like, like, db.Table("taggings").
+				Select("taggings.article_id").
+				Joins("JOIN tags ON tags.id = taggings.tag_id").
+				Where("LOWER(tags.name) LIKE ?", like).
+				SubQuery())
+	}
+
+	var articles []Article
+	if err := query.Limit(searchCandidateLimit).Find(&articles).Error; err != nil {
+		return nil, 0, err
+	}
+
+	results := rankArticles(articles, terms)
+	return paginateResults(results, q.Limit, q.Offset), len(results), nil
+}
+
+// hasFullTextIndex reports whether the articles_fts table exists. It is
+// only created on SQLite builds with FTS5 enabled.
+func (db *DB) hasFullTextIndex() bool {
+	return db.Dialect().GetName() == "sqlite3" && db.HasTable("articles_fts")
+}
+
+func (db *DB) searchFullText(q SearchQuery, terms []string) ([]SearchResult, int, error) {
+	// Every term is quoted so the query can't use the FTS5 syntax, and
+	// matches as a prefix like in the fallback
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	match := strings.Join(quoted, " AND ")
+
+	const from = ` FROM articles_fts JOIN articles ON articles.id = articles_fts.rowid
+		WHERE articles_fts MATCH ? AND articles.deleted_at IS NULL
+		AND (articles.status = ? OR articles.user_id = ?)`
+
+	var total int
+	err := db.Raw("SELECT COUNT(*)"+from, match, StatusPublished, q.ViewerID).Row().Scan(&total)
+	if err != nil || total == 0 {
+		return nil, total, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.Raw(`SELECT articles_fts.rowid,
+		bm25(articles_fts, ?, ?, ?, ?),
+		snippet(articles_fts, -1, char(2), char(3), '…', ?)`+from+`
+		ORDER BY 2, articles.created_at DESC, articles.id DESC LIMIT ? OFFSET ?`,
+		searchTitleWeight, searchDescriptionWeight, searchBodyWeight, searchTagsWeight, snippetTokens,
+		match, StatusPublished, q.ViewerID, limit, q.Offset).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	var ids []int
+	for rows.Next() {
+		var r SearchResult
+		var rank float64
+		if err := rows.Scan(&r.Article.ID, &rank, &r.Snippet); err != nil {
+			return nil, 0, err
+		}
+		// bm25 scores are negative, the lower the better
+		r.Rank = -rank
+		r.Snippet = markSnippet(r.Snippet)
+		results = append(results, r)
+		ids = append(ids, r.Article.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var articles []Article
+	if err := db.Scopes(defaultScope).Where("articles.id IN (?)", ids).Find(&articles).Error; err != nil {
+		return nil, 0, err
+	}
+
+	byID := make(map[int]Article, len(articles))
+	for _, a := range articles {
+		byID[a.ID] = a
+	}
+	for i := range results {
+		results[i].Article = byID[results[i].Article.ID]
+	}
+
+	return results, total, nil
+}
+
+// indexArticle writes the article content to the full text index
+func (db *DB) indexArticle(article *Article) error {
+	if !db.hasFullTextIndex() {
+		return nil
+	}
+
+	if err := db.unindexArticle(article.ID); err != nil {
+		return err
+	}
+
+	var tags []string
+	for _, t := range article.Tags {
+		tags = append(tags, t.Name)
+	}
+
+	return db.Exec("INSERT INTO articles_fts (rowid, title, description, body, tags) VALUES (?, ?, ?, ?, ?)",
+		article.ID, article.Title, article.Description, article.Body, strings.Join(tags, " ")).Error
+}
+
+// unindexArticle removes an article from the full text index
+func (db *DB) unindexArticle(articleID int) error {
+	if !db.hasFullTextIndex() {
+		return nil
+	}
+	return db.Exec("DELETE FROM articles_fts WHERE rowid = ?", articleID).Error
+}
+
+// searchTerms splits a query in distinct lower case words, dropping
+// punctuation
+func searchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	seen := make(map[string]bool)
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+type token struct {
+	start, end int
+}
+
+// tokenize returns the position of the words of text
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			tokens = append(tokens, token{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start, len(text)})
+	}
+	return tokens
+}
+
+// matchedTerms returns the terms the word starts with
+func matchedTerms(word string, terms []string) []string {
+	var matched []string
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			matched = append(matched, term)
+		}
+	}
+	return matched
+}
+
+// rankArticles scores the articles by weighted term frequency, keeping the
+// ones containing every term, most relevant first
+func rankArticles(articles []Article, terms []string) []SearchResult {
+	var results []SearchResult
+	for _, a := range articles {
+		var tags []string
+		for _, t := range a.Tags {
+			tags = append(tags, t.Name)
+		}
+
+		fields := []struct {
+			text   string
+			weight float64
+		}{
+			{a.Title, searchTitleWeight},
+			{a.Description, searchDescriptionWeight},
+			{a.Body, searchBodyWeight},
+			{strings.Join(tags, " "), searchTagsWeight},
+		}
+
+		found := make(map[string]bool)
+		rank := 0.0
+		best, bestScore := "", 0.0
+		for _, f := range fields {
+			score := 0.0
+			for _, t := range tokenize(f.text) {
+				matched := matchedTerms(f.text[t.start:t.end], terms)
+				for _, term := range matched {
+					found[term] = true
+				}
+				if len(matched) > 0 {
+					score += f.weight
+				}
+			}
+			rank += score
+			if score > bestScore {
+				best, bestScore = f.text, score
+			}
+		}
+
+		if len(found) < len(terms) {
+			continue
+		}
+
+		results = append(results, SearchResult{
+			Article: a,
+			Rank:    rank,
+			Snippet: snippet(best, terms),
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if !a.Article.CreatedAt.Equal(b.Article.CreatedAt) {
+			return a.Article.CreatedAt.After(b.Article.CreatedAt)
+		}
+		return a.Article.ID > b.Article.ID
+	})
+
+	return results
+}
+
+// snippet returns snippetTokens words of text around its first match, with
+// the matches highlighted the same way FTS5 snippet() does
+func snippet(text string, terms []string) string {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	first := 0
+	for i, t := range tokens {
+		if len(matchedTerms(text[t.start:t.end], terms)) > 0 {
+			first = i
+			break
+		}
+	}
+
+	from := first - snippetTokens/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetTokens
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("…")
+	}
+
+	pos := tokens[from].start
+	for _, t := range tokens[from:to] {
+		sb.WriteString(text[pos:t.start])
+		word := text[t.start:t.end]
+		if len(matchedTerms(word, terms)) > 0 {
+			sb.WriteString(markStart + word + markEnd)
+		} else {
+			sb.WriteString(word)
+		}
+		pos = t.end
+	}
+
+	if to < len(tokens) {
+		sb.WriteString("…")
+	}
+
+	return markSnippet(sb.String())
+}
+
+// markSnippet escapes a snippet and turns its match markers into <mark>
+func markSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.Replace(s, markStart, "<mark>", -1)
+	return strings.Replace(s, markEnd, "</mark>", -1)
+}
+
+func paginateResults(results []SearchResult, limit, offset int) []SearchResult {
+	if offset > 0 {
+		if offset >= len(results) {
+			return nil
+		}
+		results = results[offset:]
+	}
+
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+
+	return results
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	got := searchTerms(`Go, "gophers" & go-routines!`)
+	want := []string{"go", "gophers", "routines"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("should split the query in distinct words: got %v want %v", got, want)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty"
+
+	got := snippet(text, []string{"ten"})
+	want := "…six seven eight nine <mark>ten</mark> eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty"
+
+	if got != want {
+		t.Errorf("should show the words around the first match: got %q want %q", got, want)
+	}
+
+	got = snippet("Fish & <chips>", []string{"chip"})
+	want = "Fish &amp; &lt;<mark>chips</mark>"
+
+	if got != want {
+		t.Errorf("should escape the snippet: got %q want %q", got, want)
+	}
+}
+
+func TestDB_SearchCandidateLimit(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitSchema(); err != nil {
+		t.Fatal(err)
+	}
+	SeedStore(db)
+	if db.hasFullTextIndex() {
+		t.Skip("the candidates are only bounded without FTS5")
+	}
+
+	defer func(limit int) { searchCandidateLimit = limit }(searchCandidateLimit)
+	searchCandidateLimit = 2
+
+	results, total, err := db.SearchArticles(SearchQuery{Query: "title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var slugs []string
+	for _, r := range results {
+		slugs = append(slugs, r.Article.Slug)
+	}
+	if want := []string{"title-5", "title-4"}; !reflect.DeepEqual(slugs, want) || total != 2 {
+		t.Errorf("should only rank the most recent matches: got %v (%v) want %v", slugs, total, want)
+	}
+}
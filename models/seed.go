@@ -2,7 +2,14 @@ package models
 
 import "fmt"
 
+// Seed fills the database with the fixtures used by the tests
 func (db *DB) Seed() {
+	SeedStore(db)
+}
+
+// SeedStore creates two users and five articles tagged with three
+// distinct tags each. Every article is favorited by its author.
+func SeedStore(s Datastorer) error {
 	user1 := User{
 		Username: "user1",
 		Bio:      "Bio user 1",
@@ -19,15 +26,11 @@ func (db *DB) Seed() {
 		Image:    "http://image.com/user2.png",
 	}
 
-	db.Create(&user1)
-	db.Create(&user2)
-
-	// Tags
-	var tags []Tag
-	for i := 0; i < 15; i++ {
-		tag := Tag{Name: fmt.Sprintf("tag%d", i)}
-		db.Create(&tag)
-		tags = append(tags, tag)
+	users := []*User{&user1, &user2}
+	for _, u := range users {
+		if err := s.CreateUser(u); err != nil {
+			return err
+		}
 	}
 
 	// Articles
@@ -38,27 +41,28 @@ func (db *DB) Seed() {
 			Description: fmt.Sprintf("Description %d", i+1),
 			Body:        fmt.Sprintf("Body %d", i+1),
 			Tags: []Tag{
-				tags[tagIndex],
-				tags[tagIndex+1],
-				tags[tagIndex+2],
+				{Name: fmt.Sprintf("tag%d", tagIndex)},
+				{Name: fmt.Sprintf("tag%d", tagIndex+1)},
+				{Name: fmt.Sprintf("tag%d", tagIndex+2)},
 			},
-			UserID: (i % 2) + 1,
+			UserID: users[i%2].ID,
 		}
 
-		db.Create(&a)
+		if err := s.CreateArticle(&a); err != nil {
+			return err
+		}
 
-		db.Model(&a).Association("Favorites").Append(Favorite{
-			UserID:    a.UserID,
-			ArticleID: a.ID,
-		})
+		if err := s.FavoriteArticle(a.UserID, a.ID); err != nil {
+			return err
+		}
 
 		tagIndex += 3
 	}
+
+	return nil
 }
 
 func (db *DB) CleanDatabase() {
-	db.DropTable("users")
-	db.DropTable("articles")
-	db.DropTable("tags")
-	db.DropTable("favorites")
+	db.MigrateDown(len(migrations))
+	db.DropTableIfExists(&SchemaMigration{})
 }
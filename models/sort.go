@@ -0,0 +1,136 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Article list orders
+const (
+	SortNewest        = "newest"
+	SortOldest        = "oldest"
+	SortMostFavorited = "most-favorited"
+	SortTrending      = "trending"
+)
+
+// Sorts lists the supported article list orders
+var Sorts = []string{SortNewest, SortOldest, SortMostFavorited, SortTrending}
+
+// DefaultTrendingWindow is how far back favorites count towards trending
+const DefaultTrendingWindow = 7 * 24 * time.Hour
+
+// IsValidSort check if sort is one of Sorts, the empty sort means newest
+func IsValidSort(sort string) bool {
+	if sort == "" {
+		return true
+	}
+	for _, s := range Sorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// trendingWeight weights a favorite by its age: favorites from the last
+// quarter of the window count 4 times, from the last half twice and older
+// ones once. Favorites out of the window don't count.
+func trendingWeight(age, window time.Duration) int {
+	switch {
+	case age <= window/4:
+		return 4
+	case age <= window/2:
+		return 2
+	case age <= window:
+		return 1
+	}
+	return 0
+}
+
+// sortArticles orders the query by q.Sort, newest first by default. Ties
+// are broken by recency.
+func (db *DB) sortArticles(query *gorm.DB, q ArticleQuery) *gorm.DB {
+	switch q.Sort {
+	case SortOldest:
+		return query.Order("articles.created_at asc", true).Order("articles.id asc")
+
+	case SortMostFavorited:
+		return query.Order("articles.favorites_count desc", true).
+			Order("articles.created_at desc").
+			Order("articles.id desc")
+
+	case SortTrending:
+		window := q.TrendingWindow
+		if window <= 0 {
+			window = DefaultTrendingWindow
+		}
+		now := time.Now()
+
+		// Only the favorites of the window are aggregated, using
+		// idx_favorites_created_at, the same steps as trendingWeight
+		trending := db.Table("favorites").
+			Select("article_id, SUM(CASE WHEN created_at >= ? THEN 4 WHEN created_at >= ? THEN 2 ELSE 1 END) AS score",
+				now.Add(-window/4), now.Add(-window/2)).
+			Where("created_at >= ?", now.Add(-window)).
+			Group("article_id").
+			SubQuery()
+
+		return query.Select("articles.*").
+			Joins("LEFT JOIN ? trending ON trending.article_id = articles.id", trending).
+			Order("COALESCE(trending.score, 0) desc", true).
+			Order("articles.created_at desc").
+			Order("articles.id desc")
+	}
+
+	return query
+}
+
+// sortArticles orders the articles like DB.sortArticles
+func (m *MemoryStore) sortArticles(articles []Article, q ArticleQuery) {
+	newest := func(a, b Article) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	}
+
+	var less func(a, b Article) bool
+	switch q.Sort {
+	case SortOldest:
+		less = func(a, b Article) bool { return newest(b, a) }
+
+	case SortMostFavorited:
+		less = func(a, b Article) bool {
+			if a.FavoritesCount != b.FavoritesCount {
+				return a.FavoritesCount > b.FavoritesCount
+			}
+			return newest(a, b)
+		}
+
+	case SortTrending:
+		window := q.TrendingWindow
+		if window <= 0 {
+			window = DefaultTrendingWindow
+		}
+		now := time.Now()
+
+		scores := make(map[int]int)
+		for _, f := range m.favorites {
+			scores[f.ArticleID] += trendingWeight(now.Sub(f.CreatedAt), window)
+		}
+
+		less = func(a, b Article) bool {
+			if scores[a.ID] != scores[b.ID] {
+				return scores[a.ID] > scores[b.ID]
+			}
+			return newest(a, b)
+		}
+
+	default:
+		less = newest
+	}
+
+	sort.Slice(articles, func(i, j int) bool { return less(articles[i], articles[j]) })
+}
@@ -1,11 +1,28 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/text/unicode/norm"
+)
+
 type TagStorer interface {
 	FindTag(*Tag) error
 	FindTags(tags *[]Tag) error
 	FindTagOrInit(string) (Tag, error)
+	FindOrCreateTag(string) (Tag, error)
+	CreateTagAlias(string, string) error
+	MergeTags(string, string) (*Tag, error)
 }
 
+var (
+	errSameTag     = fmt.Errorf("Cannot merge a tag into itself")
+	errTagNameUsed = fmt.Errorf("A tag already uses this name")
+	errAliasTaken  = fmt.Errorf("This alias already exists")
+)
+
 type Tag struct {
 	ID            uint
 	Name          string `gorm:"unique"`
@@ -13,15 +30,231 @@ type Tag struct {
 	Articles      []Article `gorm:"many2many:taggings;"`
 }
 
+// TagAlias makes a synonym resolve to its canonical tag
+type TagAlias struct {
+	ID    uint
+	Name  string `gorm:"unique"`
+	TagID uint   `gorm:"index"`
+}
+
+// NormalizeTagName returns the canonical form of a tag name: Unicode NFKC,
+// lower case, with whitespace trimmed and collapsed to single spaces.
+// "Go", " go " and "ＧＯ" all normalize to "go".
+func NormalizeTagName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(norm.NFKC.String(name))), " ")
+}
+
+// BeforeSave normalizes the tag name, including for tags saved along
+// with an article
+func (t *Tag) BeforeSave() error {
+	t.Name = NormalizeTagName(t.Name)
+	return nil
+}
+
 func (db *DB) FindTag(tag *Tag) error {
-	return db.Where(&tag).Find(&tag).Error
+	return db.Where(tag).First(tag).Error
 }
 
 func (db *DB) FindTags(tags *[]Tag) error {
-	return db.Model(&Tag{}).Find(&tags).Error
+	return db.Model(&Tag{}).Order("name").Find(tags).Error
+}
+
+// canonicalTagName normalizes a tag name and resolves its alias if any
+func (db *DB) canonicalTagName(name string) (string, error) {
+	name = NormalizeTagName(name)
+
+	var tag Tag
+	err := db.Joins("JOIN tag_aliases ON tag_aliases.tag_id = tags.id").
+		Where("tag_aliases.name = ?", name).
+		First(&tag).Error
+	if err == nil {
+		return tag.Name, nil
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		return name, nil
+	}
+	return "", err
+}
+
+// canonicalTagNames resolves the canonical name of every tag, dropping
+// duplicates
+func (db *DB) canonicalTagNames(names []string) ([]string, error) {
+	var canonical []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name, err := db.canonicalTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			canonical = append(canonical, name)
+		}
+	}
+	return canonical, nil
 }
 
 func (db *DB) FindTagOrInit(tagName string) (tag Tag, err error) {
+	if tagName, err = db.canonicalTagName(tagName); err != nil {
+		return
+	}
 	err = db.DB.FirstOrInit(&tag, Tag{Name: tagName}).Error
 	return
 }
+
+// FindOrCreateTag returns the tag with the given name, or the tag it is an
+// alias of, creating it if needed.
+// Concurrent creations of the same tag fail on the unique name constraint,
+// see RetryOnConflict.
+func (db *DB) FindOrCreateTag(tagName string) (tag Tag, err error) {
+	if tagName, err = db.canonicalTagName(tagName); err != nil {
+		return
+	}
+	err = db.DB.FirstOrCreate(&tag, Tag{Name: tagName}).Error
+	return
+}
+
+// CreateTagAlias makes alias resolve to the existing tag tagName
+func (db *DB) CreateTagAlias(alias string, tagName string) error {
+	return db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+
+		alias = NormalizeTagName(alias)
+		if err := tx.FindTag(&Tag{Name: alias}); err == nil {
+			return errTagNameUsed
+		}
+
+		if !tx.Where("name = ?", alias).First(&TagAlias{}).RecordNotFound() {
+			return errAliasTaken
+		}
+
+		tag := Tag{Name: NormalizeTagName(tagName)}
+		if err := tx.FindTag(&tag); err != nil {
+			return err
+		}
+
+		return tx.Create(&TagAlias{Name: alias, TagID: tag.ID}).Error
+	})
+}
+
+// MergeTags moves every article tagged from to the tag into, deletes from
+// and keeps its name as an alias of into. It returns into with its
+// recomputed TaggingsCount.
+func (db *DB) MergeTags(from string, into string) (*Tag, error) {
+	src := Tag{Name: NormalizeTagName(from)}
+	dst := Tag{Name: NormalizeTagName(into)}
+	if src.Name == dst.Name {
+		return nil, errSameTag
+	}
+
+	err := db.WithTx(func(s Datastorer) error {
+		tx := s.(*DB)
+		if err := tx.FindTag(&src); err != nil {
+			return err
+		}
+		if err := tx.FindTag(&dst); err != nil {
+			return err
+		}
+
+		var articleIDs []int
+		err := tx.Table("taggings").Where("tag_id = ?", src.ID).Pluck("article_id", &articleIDs).Error
+		if err != nil {
+			return err
+		}
+
+		// Articles tagged with both tags keep a single tagging
+		var tagged []int
+		err = tx.Table("taggings").Where("tag_id = ?", dst.ID).Pluck("article_id", &tagged).Error
+		if err != nil {
+			return err
+		}
+		if len(tagged) > 0 {
+			err = tx.Exec("DELETE FROM taggings WHERE tag_id = ? AND article_id IN (?)", src.ID, tagged).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		steps := []struct {
+			sql  string
+			args []interface{}
+		}{
+			{"UPDATE taggings SET tag_id = ? WHERE tag_id = ?", []interface{}{dst.ID, src.ID}},
+			{"UPDATE tag_aliases SET tag_id = ? WHERE tag_id = ?", []interface{}{dst.ID, src.ID}},
+			{"DELETE FROM tags WHERE id = ?", []interface{}{src.ID}},
+			{recountTaggingsSQL + " WHERE id = ?", []interface{}{dst.ID}},
+		}
+		for _, step := range steps {
+			if err := tx.Exec(step.sql, step.args...).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&TagAlias{Name: src.Name, TagID: dst.ID}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&dst, dst.ID).Error; err != nil {
+			return err
+		}
+
+		return tx.reindexArticles(articleIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dst, nil
+}
+
+// recountTaggingsSQL recomputes the tags TaggingsCount from the taggings
+// of the articles that aren't deleted
+const recountTaggingsSQL = `UPDATE tags SET taggings_count =
+	(SELECT COUNT(*) FROM taggings JOIN articles ON articles.id = taggings.article_id
+		WHERE taggings.tag_id = tags.id AND articles.deleted_at IS NULL)`
+
+// articleTagIDs returns the ids of the tags of the articles
+func (db *DB) articleTagIDs(articleIDs ...int) ([]uint, error) {
+	var tagIDs []uint
+	err := db.Table("taggings").Where("article_id IN (?)", articleIDs).Pluck("DISTINCT tag_id", &tagIDs).Error
+	return tagIDs, err
+}
+
+// recountTags recomputes the TaggingsCount of the tags, after articles
+// using them were written
+func (db *DB) recountTags(tagIDs []uint) error {
+	if len(tagIDs) == 0 {
+		return nil
+	}
+	return db.Exec(recountTaggingsSQL+" WHERE id IN (?)", tagIDs).Error
+}
+
+// recountArticleTags recomputes the TaggingsCount of the tags of the
+// articles
+func (db *DB) recountArticleTags(articleIDs ...int) error {
+	tagIDs, err := db.articleTagIDs(articleIDs...)
+	if err != nil {
+		return err
+	}
+	return db.recountTags(tagIDs)
+}
+
+// reindexArticles refreshes the full text index of the articles after
+// their tags changed
+func (db *DB) reindexArticles(articleIDs []int) error {
+	if len(articleIDs) == 0 || !db.hasFullTextIndex() {
+		return nil
+	}
+
+	var articles []Article
+	if err := db.Preload("Tags").Where("id IN (?)", articleIDs).Find(&articles).Error; err != nil {
+		return err
+	}
+
+	for i := range articles {
+		if err := db.indexArticle(&articles[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
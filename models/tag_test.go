@@ -0,0 +1,23 @@
+package models
+
+import "testing"
+
+func TestNormalizeTagName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Go", "go"},
+		{" go ", "go"},
+		{"Go\tLang", "go lang"},
+		{"ＧＯ", "go"},
+		{"Café", "café"},
+		{"   ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeTagName(tt.name); got != tt.want {
+			t.Errorf("should normalize %q: got %q want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type TokenStorer interface {
+	CreateAPIToken(*APIToken) error
+	FindAPITokens(int) ([]APIToken, error)
+	FindAPITokenByHash(string) (*APIToken, error)
+	TouchAPIToken(*APIToken) error
+	RevokeAPIToken(int, int) error
+}
+
+// APIToken is a named personal access token. Only the SHA-256 hash of the
+// secret is stored, the secret itself is shown once on creation.
+type APIToken struct {
+	ID         int
+	User       User `gorm:"association_autoupdate:false"`
+	UserID     int  `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"unique_index"`
+	Scopes     string
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// NewAPIToken returns a new APIToken for the user along with the raw secret
+// that must be handed to the client.
+func NewAPIToken(user *User, name string, scopes []string, prefix string) (*APIToken, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("Token name can't be blank")
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("Token needs at least one scope")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := prefix + hex.EncodeToString(b)
+
+	return &APIToken{
+		User:      *user,
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: HashAPIToken(secret),
+		Scopes:    strings.Join(scopes, " "),
+	}, secret, nil
+}
+
+// HashAPIToken returns the hex encoded SHA-256 of the raw token
+func HashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ScopeList returns the token scopes as a slice
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// CreateAPIToken persist a new token
+func (db *DB) CreateAPIToken(token *APIToken) error {
+	return db.Create(token).Error
+}
+
+// FindAPITokens returns all the tokens of a user
+func (db *DB) FindAPITokens(userID int) (tokens []APIToken, err error) {
+	err = db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error
+	return
+}
+
+// FindAPITokenByHash retrieve a token and its owner by the token hash
+func (db *DB) FindAPITokenByHash(hash string) (*APIToken, error) {
+	var token APIToken
+	err := db.Preload("User").First(&token, "token_hash = ?", hash).Error
+	return &token, err
+}
+
+// TouchAPIToken records the token as just used
+func (db *DB) TouchAPIToken(token *APIToken) error {
+	now := time.Now()
+	token.LastUsedAt = &now
+	return db.Model(token).UpdateColumn("last_used_at", now).Error
+}
+
+// RevokeAPIToken deletes a token owned by the user
+func (db *DB) RevokeAPIToken(userID int, tokenID int) error {
+	res := db.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&APIToken{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("No token found with id: %d", tokenID)
+	}
+	return nil
+}
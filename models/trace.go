@@ -0,0 +1,59 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const querySpanKey = "trace:query_span"
+
+// TraceQueries records a span for every query run through gorm, child of
+// the span of the context given to WithContext. Like InstrumentQueries,
+// statements run with Exec are not traced.
+func (db *DB) TraceQueries(tracer trace.Tracer) {
+	dialect := db.Dialect().GetName()
+
+	start := func(operation string) func(*gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			if skipsQuery(scope) {
+				return
+			}
+			table := queryTable(scope)
+			_, span := tracer.Start(queryContext(scope), operation+" "+table,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("db.system", dialect),
+					attribute.String("db.operation.name", operation),
+					attribute.String("db.collection.name", table),
+				))
+			scope.InstanceSet(querySpanKey, span)
+		}
+	}
+	end := func(scope *gorm.Scope) {
+		v, ok := scope.InstanceGet(querySpanKey)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		span.SetAttributes(attribute.String("db.query.text", scope.SQL))
+		if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	callbacks := db.Callback()
+	callbacks.Create().Before("gorm:create").Register("trace:create_start", start("create"))
+	callbacks.Create().After("gorm:create").Register("trace:create_end", end)
+	callbacks.Query().Before("gorm:query").Register("trace:query_start", start("query"))
+	callbacks.Query().After("gorm:query").Register("trace:query_end", end)
+	callbacks.RowQuery().Before("gorm:row_query").Register("trace:row_query_start", start("row_query"))
+	callbacks.RowQuery().After("gorm:row_query").Register("trace:row_query_end", end)
+	callbacks.Update().Before("gorm:update").Register("trace:update_start", start("update"))
+	callbacks.Update().After("gorm:update").Register("trace:update_end", end)
+	callbacks.Delete().Before("gorm:delete").Register("trace:delete_start", start("delete"))
+	callbacks.Delete().After("gorm:delete").Register("trace:delete_end", end)
+}
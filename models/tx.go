@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// WithTx runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back otherwise. Calling WithTx on the Datastorer
+// given to fn reuses the running transaction.
+func (db *DB) WithTx(fn func(Datastorer) error) (err error) {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fn(db)
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(&DB{tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// IsConflict check if the error was caused by a unique constraint violation
+func IsConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint") || // sqlite
+		strings.Contains(msg, "duplicate key") || // postgres
+		strings.Contains(msg, "duplicate entry") // mysql
+}
+
+// RetryOnConflict calls fn until it succeeds, fails with an error other than
+// a unique constraint violation or was called the given number of times.
+// It lets concurrent transactions inserting the same row retry and find it.
+func RetryOnConflict(attempts int, fn func() error) (err error) {
+	for i := 0; i < attempts; i++ {
+		if err = fn(); !IsConflict(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -3,13 +3,12 @@ package models
 import (
 	"fmt"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserStorer interface {
 	CreateUser(*User) error
 	FindUserByEmail(string) (*User, error)
+	UpdatePassword(*User) error
 }
 
 type User struct {
@@ -23,24 +22,43 @@ type User struct {
 }
 
 func (u *User) MatchPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+	return VerifyPassword(u.Password, password)
+}
+
+// PasswordNeedsRehash check if the stored hash uses outdated parameters
+func (u *User) PasswordNeedsRehash() bool {
+	return PasswordNeedsRehash(u.Password)
+}
+
+// SetPassword hashes the password with the current PasswordHasher
+func (u *User) SetPassword(password string) error {
+	hash, err := EncryptPassword(password)
+	if err != nil {
+		return err
+	}
+	u.Password = hash
+	return nil
 }
 
-func EncryptPassword(password string) string {
-	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hash)
+func EncryptPassword(password string) (string, error) {
+	return PasswordHasher.Hash(password)
 }
 
 func NewUser(email, username, password string) (*User, error) {
 	if email == "" || username == "" || password == "" {
 		return nil, fmt.Errorf("Provided with empty fields")
 	}
-	return &User{
+
+	u := &User{
 		Email:    email,
 		Username: username,
-		Password: EncryptPassword(password),
-	}, nil
+	}
+
+	if err := u.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	return u, nil
 }
 
 func (db *DB) CreateUser(user *User) error {
@@ -65,7 +83,12 @@ func (db *DB) FindUserByEmail(email string) (*User, error) {
 	u := User{}
 	db.Find(&u, "email = ?", email)
 	if u == (User{}) {
-		return nil, fmt.Errorf("No user found with userame: ", email)
+		return nil, fmt.Errorf("no user found with email: %s", email)
 	}
 	return &u, nil
 }
+
+// UpdatePassword persist the user password hash
+func (db *DB) UpdatePassword(user *User) error {
+	return db.Model(user).UpdateColumn("password", user.Password).Error
+}
@@ -0,0 +1,73 @@
+// Package tracing sets up OpenTelemetry tracing: the W3C trace context
+// propagation and the exporter of the spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the name of the tracer and the default service name
+const Name = "conduit"
+
+// Tracer returns the tracer of the server, it records nothing until Setup
+// installs an exporter
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// Setup propagates the trace context of requests with the W3C traceparent
+// and tracestate headers and exports the spans with exporter:
+//   - "otlp": to an OpenTelemetry collector over HTTP, configured with the
+//     standard OTEL_EXPORTER_OTLP_* variables, http://localhost:4318 by
+//     default
+//   - "stdout": as JSON lines on the standard output
+//   - "" or "none": nowhere, spans are not recorded
+//
+// The service name is taken from OTEL_SERVICE_NAME when set. The returned
+// function flushes the spans left and must be called before exiting.
+func Setup(ctx context.Context, exporter string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("Unknown traces exporter: %s", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", Name)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}